@@ -0,0 +1,82 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package cmd
+
+import (
+	"github.com/erayan/k8s-wait-for-multi/pkg"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var contextConfigFlags = map[string]*genericclioptions.ConfigFlags{}
+
+// getConfigFlags returns the config flags for a kubeconfig context, the empty string is the current context.
+// Other contexts are loaded from the same kubeconfig, flags that override the cluster or the user are not applied to them.
+func getConfigFlags(context string) *genericclioptions.ConfigFlags {
+	if context == "" {
+		return KubernetesConfigFlags
+	}
+
+	if configFlags, ok := contextConfigFlags[context]; ok {
+		return configFlags
+	}
+
+	configFlags := genericclioptions.NewConfigFlags(true)
+	configFlags.KubeConfig = KubernetesConfigFlags.KubeConfig
+	configFlags.CacheDir = KubernetesConfigFlags.CacheDir
+	configFlags.Timeout = KubernetesConfigFlags.Timeout
+	configFlags.Context = pointer.String(context)
+
+	contextConfigFlags[context] = configFlags
+	return configFlags
+}
+
+func getRESTMapper(context string) (meta.RESTMapper, error) {
+	return getConfigFlags(context).ToRESTMapper()
+}
+
+// getDiagnosticsClients creates the clients that read the diagnostics of a kubeconfig context, they do not use the caches
+// because those are stopped once the wait ended.
+func getDiagnosticsClients(context string) (*pkg.DiagnosticsClients, error) {
+	configFlags := getConfigFlags(context)
+
+	conf, err := configFlags.ToRESTConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	mapper, err := configFlags.ToRESTMapper()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := client.New(conf, client.Options{Mapper: mapper})
+	if err != nil {
+		return nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pkg.DiagnosticsClients{Client: c, Clientset: clientset}, nil
+}
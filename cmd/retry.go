@@ -0,0 +1,196 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/erayan/k8s-wait-for-multi/pkg"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	// retryBaseDelay and retryMaxDelay bound the exponential backoff between retries of an object that could not be processed.
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+	// syncRetryDelay is how long processing an object waits for the informer of a kind it looks up to sync.
+	syncRetryDelay = 100 * time.Millisecond
+)
+
+// retryKey identifies an object of which the processing is retried.
+type retryKey struct {
+	cluster   *pkg.Cluster
+	gvk       schema.GroupVersionKind
+	namespace string
+	name      string
+}
+
+func (k retryKey) String() string {
+	kind := strings.ToLower(k.gvk.Kind)
+	if k.namespace == "" {
+		return fmt.Sprintf("%s/%s", kind, k.name)
+	}
+	return fmt.Sprintf("%s/%s/%s", k.namespace, kind, k.name)
+}
+
+// retryQueue holds the objects of which the processing is retried, it is guarded by mu.
+var retryQueue workqueue.TypedRateLimitingInterface[retryKey]
+
+// pendingRetries holds the latest processing of every object in the retryQueue, it is guarded by mu.
+var pendingRetries = map[retryKey]func(ctx context.Context) (bool, error){}
+
+// startRetries processes a new retryQueue until the context is done.
+// The queue of a previous wait is only used by its own goroutines, which end once its context is done.
+func startRetries(ctx context.Context) {
+	queue := workqueue.NewTypedRateLimitingQueue(workqueue.NewTypedItemExponentialFailureRateLimiter[retryKey](retryBaseDelay, retryMaxDelay))
+	mu.Lock()
+	retryQueue = queue
+	mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		queue.ShutDown()
+	}()
+
+	go func() {
+		for {
+			key, shutdown := queue.Get()
+			if shutdown {
+				return
+			}
+			retryEvent(ctx, key)
+			queue.Done(key)
+		}
+	}()
+}
+
+func retryEvent(ctx context.Context, key retryKey) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	// a later event of the object may have been processed successfully in the meantime
+	if process, ok := pendingRetries[key]; ok && ctx.Err() == nil {
+		processEvent(ctx, key, process)
+	}
+}
+
+// processEvent processes an object, when that fails the error is shown on the items of the object and processing it
+// is retried with backoff. Persistent errors (e.g. forbidden) fail the wait once they were retried --error-retry-limit times.
+// Objects that look up a kind of which the informer did not sync yet are processed again shortly, that is not counted as a retry.
+// It needs to be called with mu held.
+func processEvent(ctx context.Context, key retryKey, process func(ctx context.Context) (bool, error)) {
+	matches, err := process(ctx)
+	var notSynced *pkg.NotSyncedError
+	if errors.As(err, &notSynced) {
+		// not a failure of the object, it is processed again once the informer synced
+		pendingRetries[key] = process
+		retryQueue.AddAfter(key, syncRetryDelay)
+	} else if err != nil {
+		if isPersistentError(err) && retryQueue.NumRequeues(key) >= *WaitForConfigFlags.ErrorRetryLimit {
+			failWait(&pkg.APIError{Err: fmt.Errorf("unable to process %s: %w", key, err)})
+			return
+		}
+		log.Printf("Unable to process %s, retrying: %s", key, err.Error())
+		key.cluster.SetObjectError(key.gvk, key.namespace, key.name, err.Error())
+		pendingRetries[key] = process
+		retryQueue.AddRateLimited(key)
+		matches = true
+	} else if _, ok := pendingRetries[key]; ok {
+		delete(pendingRetries, key)
+		retryQueue.Forget(key)
+		key.cluster.SetObjectError(key.gvk, key.namespace, key.name, "")
+		matches = true
+	}
+
+	if matches {
+		processChange(ctx)
+	}
+}
+
+// watchErrorKey identifies the informer of a kind in a kubeconfig context.
+type watchErrorKey struct {
+	context string
+	kind    string
+}
+
+// watchErrors counts the persistent list and watch errors of every informer, it is guarded by mu.
+var watchErrors = map[watchErrorKey]int{}
+
+// newWatchErrorHandler returns the handler of the list and watch errors of the informers of the cluster.
+// The informers retry those by themselves, but their kind never syncs while they fail, so persistent errors (e.g. forbidden)
+// of kinds the items need fail the wait once they occurred more than --error-retry-limit times.
+func newWatchErrorHandler(cluster *pkg.Cluster) toolscache.WatchErrorHandlerWithContext {
+	return func(ctx context.Context, r *toolscache.Reflector, err error) {
+		toolscache.DefaultWatchErrorHandler(ctx, r, err)
+		if !isPersistentError(err) {
+			return
+		}
+
+		gvk, found := getWatchErrorKind(cluster.GetName(), err)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if found && !cluster.SetWatchError(gvk, err) {
+			return
+		}
+
+		key := watchErrorKey{context: cluster.GetName(), kind: r.TypeDescription()}
+		watchErrors[key]++
+		if watchErrors[key] > *WaitForConfigFlags.ErrorRetryLimit {
+			if cluster.GetName() != "" {
+				err = fmt.Errorf("in context %s: %w", cluster.GetName(), err)
+			}
+			failWait(&pkg.APIError{Err: fmt.Errorf("unable to watch %s: %w", key.kind, err)})
+		}
+	}
+}
+
+// getWatchErrorKind returns the kind an informer can not list or watch from the details of the error.
+// Unauthorized errors do not have those, they apply to every kind.
+func getWatchErrorKind(contextName string, err error) (schema.GroupVersionKind, bool) {
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) || status.Status().Details == nil {
+		return schema.GroupVersionKind{}, false
+	}
+	details := status.Status().Details
+
+	mapper, err := getRESTMapper(contextName)
+	if err != nil {
+		return schema.GroupVersionKind{}, false
+	}
+
+	gvk, err := mapper.KindFor(schema.GroupVersionResource{Group: details.Group, Resource: details.Kind})
+	if err != nil {
+		return schema.GroupVersionKind{}, false
+	}
+	return gvk, true
+}
+
+// isPersistentError returns true for errors that are not expected to go away by retrying.
+func isPersistentError(err error) bool {
+	return apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err)
+}
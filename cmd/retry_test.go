@@ -0,0 +1,76 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/erayan/k8s-wait-for-multi/pkg"
+)
+
+func TestProcessEventRequeuesUntilSynced(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cancelFn = cancel
+	waitErr = nil
+
+	waits = pkg.NewWaitables(WaitForConfigFlags).WithLock(&mu)
+	target, err := pkg.ParseTarget("default,pod,web", pkg.Target{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := waits.AddTarget(target); err != nil {
+		t.Fatal(err)
+	}
+	startRetries(ctx)
+
+	key := retryKey{cluster: waits.GetClusters()[0], gvk: pkg.PodGVK, namespace: "default", name: "web"}
+	attempts := 0
+	synced := make(chan struct{})
+	process := func(ctx context.Context) (bool, error) {
+		attempts++
+		if attempts < 3 {
+			return false, &pkg.NotSyncedError{GroupVersionKind: pkg.PodGVK}
+		}
+		close(synced)
+		return false, nil
+	}
+
+	mu.Lock()
+	processEvent(ctx, key, process)
+	mu.Unlock()
+
+	select {
+	case <-synced:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the event was not processed again after the informer synced")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if requeues := retryQueue.NumRequeues(key); requeues != 0 {
+		t.Errorf("waiting for the informer counted %d retries", requeues)
+	}
+	if _, ok := pendingRetries[key]; ok {
+		t.Errorf("the event is still pending after it was processed")
+	}
+	if waitErr != nil {
+		t.Errorf("the wait failed: %v", waitErr)
+	}
+}
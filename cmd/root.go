@@ -17,9 +17,11 @@
 package cmd
 
 import (
+	"errors"
 	"os"
 
 	"github.com/erayan/k8s-wait-for-multi/flags"
+	"github.com/erayan/k8s-wait-for-multi/pkg"
 
 	"github.com/spf13/cobra"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
@@ -42,16 +44,67 @@ var rootCmd = &cobra.Command{
 This is an implementation of k8s-wait-for that allows you to wait for multiple items in one process.
 This uses informers to get the status updates for all the items that this application is waiting for.
 
-You can omit the NAMESPACE and KIND, they default to the value of the --namespace flag and 'pod' respectively. Supported strings for KIND are service, job and pod.`,
+You can omit the NAMESPACE and KIND, they default to the value of the --namespace flag and 'pod' respectively. Supported strings for KIND are service, job, pod and owner.
+For the pod KIND the NAME can also be a label selector in brackets (e.g. default,pod,[app=web]), all matching pods are waited for.
+For the pod KIND the NAME can also be NAME/CONTAINER[:ready|started|succeeded] to wait for a single container (e.g. default,pod,web-0/istio-proxy:started).
+For the owner KIND the NAME is the owner reference in the form OWNERKIND/OWNERNAME (e.g. rollout/my-app), all pods (transitively) owned by that object are waited for.
+Any other KIND is looked up like kubectl does (e.g. deployment, crd or nodes), KIND/NAME can be used as a shorthand for KIND,NAME.
+Cluster-scoped resources can be given as :cluster,KIND,NAME or as KIND/NAME.
+Every argument can be prefixed with ctx=CONTEXT: to wait for it in another context of the kubeconfig (e.g. ctx=east:default,service,api).
+Every argument can be followed by options in the form ;KEY=VALUE, ;for=CONDITION replaces the default readiness check (e.g. default,pod,migrate;for=jsonpath='{.status.phase}'=Succeeded).
+Use ;for=delete to wait until the item does not exist anymore.
+Use NAME:succeeded or ;for=complete to wait for a pod to reach phase Succeeded, a pod in phase Failed fails the wait.
+Use ;group=NAME to add the item to a group defined with --group NAME=all|any|quorum:N, only enough members of a group need to be done.
+Use ;timeout=DURATION to fail when the item is not done in time, or ;optional;timeout=DURATION to skip it instead.
+Use ;missing-timeout=DURATION to fail when the object of the item does not exist for that long, objects that do not exist are shown as NotFound.
+Use ;min=N or ;min=PERCENT% to only require that many ready pods of a service, owner or label selector.
+Use ;fatal-reasons=REASON[,REASON...] and ;restart-limit=N to fail pods of which a container is waiting with one of those reasons (e.g. CrashLoopBackOff) or restarted that often.
+Use ;unschedulable-timeout=DURATION to fail pods that could not be scheduled for that long.
+Use ;fail-fast=false to keep waiting for an item that failed (e.g. a job that is retried by hand) instead of failing with exit code 3.
+Use ;require-new to only count a job that was created after the wait started, and ;job-missing=complete|wait|fail to decide what a job that does not exist means.
+Use ;indexes=INDEX[-INDEX][,...] to only wait until those indexes of an Indexed Job completed, e.g. ;indexes=0 for the shard that seeds the others.
+Use ;stable-for=DURATION to require the item to stay done for that long.
+Use ;id=NAME to name an item and ;after=NAME[,NAME...] to only start waiting for an item once the named items and groups are done.
+
+Exit codes: 0 everything is done, 1 invalid arguments, 2 timeout, 3 an item failed (e.g. a failed job or a crash looping pod), 4 Kubernetes API error (e.g. missing permissions).
+Objects that can not be processed and kinds that can not be listed or watched are retried, forbidden and unauthorized errors exit with code 4 after --error-retry-limit retries.
+When the wait is not done the items that are not done are printed, use --diagnostics-dir=DIR to also write their objects, pod statuses, Events and logs to DIR.
+Use --output=json to write a summary of the wait to stdout when it ends, or --output=ndjson to also write a line for every change of an item before it.`,
 	RunE:    wait,
 	Version: version,
 }
 
+// The exit codes of the wait, any other error (e.g. an invalid argument) exits with ExitCodeInvalidArgs.
+const (
+	ExitCodeDone        = 0
+	ExitCodeInvalidArgs = 1
+	// ExitCodeTimeout is used when --timeout, or the ;timeout= of a required item, expired.
+	ExitCodeTimeout = 2
+	// ExitCodeFailed is used when a required item failed, e.g. a job that reached its backoffLimit.
+	ExitCodeFailed = 3
+	// ExitCodeAPIError is used when the Kubernetes API could not be used, e.g. because of missing permissions.
+	ExitCodeAPIError = 4
+)
+
 func Execute() {
-	err := rootCmd.Execute()
-	if err != nil {
-		os.Exit(1)
+	os.Exit(getExitCode(rootCmd.Execute()))
+}
+
+func getExitCode(err error) int {
+	var timedOut *pkg.TimeoutError
+	var failed *pkg.ItemFailedError
+	var apiErr *pkg.APIError
+	switch {
+	case err == nil:
+		return ExitCodeDone
+	case errors.As(err, &timedOut):
+		return ExitCodeTimeout
+	case errors.As(err, &failed):
+		return ExitCodeFailed
+	case errors.As(err, &apiErr):
+		return ExitCodeAPIError
 	}
+	return ExitCodeInvalidArgs
 }
 
 func init() {
@@ -19,28 +19,41 @@ package cmd
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
-	"strings"
+	"os"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/erayan/k8s-wait-for-multi/pkg"
+	"github.com/erayan/k8s-wait-for-multi/pkg/conditions"
+	"github.com/erayan/k8s-wait-for-multi/pkg/items"
 	"github.com/spf13/cobra"
-	"k8s.io/utils/strings/slices"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 
 	toolscache "k8s.io/client-go/tools/cache"
 
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/utils/pointer"
 )
 
 var cancelFn context.CancelFunc
 var timeoutCtx context.Context
-var cc cache.Cache
 var mu sync.Mutex
 
+// countdownPrintInterval is how often the status is printed while items are counting down to be stable.
+const countdownPrintInterval = 5 * time.Second
+
+// diagnosticsTimeout limits how long collecting the diagnostics may take once the wait ended.
+const diagnosticsTimeout = time.Minute
+
+// waitErr is the reason the wait failed before it was done, it is guarded by mu.
+var waitErr error
+
 var waits *pkg.Waitables
 
 func wait(cmd *cobra.Command, args []string) error {
@@ -56,7 +69,12 @@ func wait(cmd *cobra.Command, args []string) error {
 		KubernetesConfigFlags.Namespace = pointer.String("default")
 	}
 
-	waits = pkg.NewWaitables(WaitForConfigFlags)
+	output, err := pkg.ParseOutputFormat(*WaitForConfigFlags.Output)
+	if err != nil {
+		return fmt.Errorf("illegal --output value: %w", err)
+	}
+
+	waits = pkg.NewWaitables(WaitForConfigFlags).WithOutput(output, os.Stdout).WithLock(&mu)
 
 	waits.Start()
 
@@ -65,76 +83,83 @@ func wait(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	if timeout < 0 {
+		return errors.New("--timeout can not be negative, zero waits forever")
+	}
 
-	timeoutCtx, cancelFn = context.WithTimeout(context.Background(), timeout)
+	if timeout > 0 {
+		timeoutCtx, cancelFn = context.WithTimeout(context.Background(), timeout)
+	} else {
+		timeoutCtx, cancelFn = context.WithCancel(context.Background())
+	}
 	defer cancelFn()
 
-	namespaces := []string{}
+	defaults := pkg.Target{Namespace: *KubernetesConfigFlags.Namespace, StableFor: *WaitForConfigFlags.StableFor, MissingTimeout: *WaitForConfigFlags.MissingTimeout, WaitOnFailure: !*WaitForConfigFlags.FailFast}
 
-	for _, arg := range args {
-		arg_items := strings.Split(arg, ",")
-		len := len(arg_items)
-		err = nil
-		if len == 1 || len == 2 {
-			if !slices.Contains(namespaces, *KubernetesConfigFlags.Namespace) {
-				namespaces = append(namespaces, *KubernetesConfigFlags.Namespace)
-			}
-		} else if len == 3 {
-			if !slices.Contains(namespaces, arg_items[0]) {
-				namespaces = append(namespaces, arg_items[0])
-			}
-		} else {
-			log.Printf("illegal argument '%s'", arg)
-		}
+	defaults.FailureRules = items.FailureRules{
+		FatalReasons:         *WaitForConfigFlags.FatalReasons,
+		RestartLimit:         *WaitForConfigFlags.RestartLimit,
+		UnschedulableTimeout: *WaitForConfigFlags.UnschedulableTimeout,
 	}
 
-	log.Printf("Starting with namespaces: %v", namespaces)
-
-	nsConfigs := map[string]cache.Config{}
-
-	for _, ns := range namespaces {
-		nsConfigs[ns] = cache.Config{}
+	defaults.RequireNew = *WaitForConfigFlags.RequireNewJobs
+	defaults.JobMissing, err = items.ParseJobMissingPolicy(*WaitForConfigFlags.JobMissing)
+	if err != nil {
+		return fmt.Errorf("illegal --job-missing value: %w", err)
 	}
 
-	opts := cache.Options{
-		DefaultNamespaces: nsConfigs,
-		SyncPeriod:        WaitForConfigFlags.SyncPeriod,
+	if *WaitForConfigFlags.OnlyOnePerServiceRequired {
+		defaults.Min = items.MinOne
 	}
 
-	conf, err := KubernetesConfigFlags.ToRESTConfig()
-	if err != nil {
-		return err
+	if *WaitForConfigFlags.For != "" {
+		defaults.Condition, err = conditions.Parse(*WaitForConfigFlags.For)
+		if err != nil {
+			return fmt.Errorf("illegal --for value: %w", err)
+		}
 	}
 
-	cc, err = cache.New(conf, opts)
-	if err != nil {
-		return err
+	for _, arg := range *WaitForConfigFlags.Groups {
+		g, err := pkg.ParseGroup(arg)
+		if err == nil {
+			err = waits.AddGroup(g)
+		}
+		if err != nil {
+			return fmt.Errorf("illegal --group value '%s': %w", arg, err)
+		}
 	}
 
-	mu = sync.Mutex{}
-	waits.WithCache(cc)
-
+	namespaces := map[string][]string{}
+	targets := []*pkg.Target{}
 	illegals := false
 
 	for _, arg := range args {
-		arg_items := strings.Split(arg, ",")
-		len := len(arg_items)
-		err = nil
-		if len == 1 {
-			err = waits.AddItem("pod", *KubernetesConfigFlags.Namespace, arg_items[0])
-			illegals = err != nil
-		} else if len == 2 {
-			err = waits.AddItem(arg_items[0], *KubernetesConfigFlags.Namespace, arg_items[1])
-			illegals = err != nil
-		} else if len == 3 {
-			err = waits.AddItem(arg_items[1], arg_items[0], arg_items[2])
-			illegals = err != nil
-		} else {
-			log.Printf("illegal argument '%s'", arg)
-			illegals = true
+		target, err := pkg.ParseTarget(arg, defaults, getRESTMapper)
+		var apiErr *pkg.APIError
+		if errors.As(err, &apiErr) {
+			return fmt.Errorf("unable to look up the kind of '%s': %w", arg, err)
 		}
 		if err != nil {
 			log.Printf("illegal argument '%s': %s", arg, err.Error())
+			illegals = true
+			continue
+		}
+		// cluster-scoped resources are cached cluster-wide next to the namespace-restricted informers
+		if !target.ClusterScoped && !slices.Contains(namespaces[target.Context], target.Namespace) {
+			namespaces[target.Context] = append(namespaces[target.Context], target.Namespace)
+		}
+		targets = append(targets, target)
+	}
+
+	if illegals {
+		return errors.New("illegal argument provided")
+	}
+
+	for i, target := range targets {
+		err = waits.AddTarget(target)
+		if err != nil {
+			log.Printf("illegal argument '%s': %s", args[i], err.Error())
+			illegals = true
 		}
 	}
 
@@ -142,97 +167,370 @@ func wait(cmd *cobra.Command, args []string) error {
 		return errors.New("illegal argument provided")
 	}
 
+	if err := waits.LinkGroups(); err != nil {
+		return fmt.Errorf("illegal --group value: %w", err)
+	}
+
+	if err := waits.LinkDependencies(); err != nil {
+		return fmt.Errorf("illegal argument provided: %w", err)
+	}
+
 	if waits.TotalCount() < 1 {
 		return errors.New("not enough arguments")
 	}
 
+	// the arguments are valid, errors from here on are not caused by their usage
+	cmd.SilenceUsage = true
+
+	startRetries(timeoutCtx)
+
+	for _, cluster := range waits.GetClusters() {
+		if cluster.GetName() == "" {
+			log.Printf("Starting with namespaces: %v", namespaces[cluster.GetName()])
+		} else {
+			log.Printf("Starting context %s with namespaces: %v", cluster.GetName(), namespaces[cluster.GetName()])
+		}
+
+		cc, err := newCache(cluster, namespaces[cluster.GetName()])
+		if err != nil {
+			return finishWait(&pkg.APIError{Err: err})
+		}
+		cluster.WithCache(cc)
+
+		err = ensureEventHandlers(timeoutCtx, cluster)
+		if err != nil {
+			return finishWait(&pkg.APIError{Err: err})
+		}
+	}
+
 	waits.PrintStatus()
 
-	if waits.HasServices() {
-		svc_informer, err := cc.GetInformerForKind(timeoutCtx, schema.FromAPIVersionAndKind("v1", "Service"))
+	go checkTimers(timeoutCtx)
+
+	err = startCaches(timeoutCtx, waits.GetClusters())
+
+	waits.Done()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err != nil {
+		failWait(&pkg.APIError{Err: err})
+	}
+
+	// the caches only stop without an error when everything is done or the timeout expired
+	if waitErr == nil && !waits.IsDone() {
+		waitErr = &pkg.TimeoutError{Timeout: timeout}
+	}
+
+	if waitErr != nil {
+		waits.PrintUnfinished()
+		if dir := *WaitForConfigFlags.DiagnosticsDir; dir != "" {
+			writeDiagnostics(dir)
+		}
+	}
+
+	return finishWait(waitErr)
+}
+
+// finishWait writes the summary of the json and ndjson output once the arguments are valid, and returns the error the wait ends with.
+func finishWait(err error) error {
+	waits.PrintSummary(err, getExitCode(err))
+	return err
+}
+
+// writeDiagnostics writes the diagnostics of the items that are not done, failing to do so does not change the outcome of the wait.
+// It needs to be called with mu held.
+func writeDiagnostics(dir string) {
+	ctx, cancel := context.WithTimeout(context.Background(), diagnosticsTimeout)
+	defer cancel()
+
+	log.Printf("Writing diagnostics to %s", dir)
+	if err := waits.WriteDiagnostics(ctx, dir, *WaitForConfigFlags.DiagnosticsLogLines, getDiagnosticsClients, waitErr); err != nil {
+		log.Printf("Unable to write diagnostics: %s", err.Error())
+	}
+}
+
+// checkTimers periodically checks the timeouts and stability of the items until the context is done.
+// While items are counting down to be stable the status is printed every countdownPrintInterval.
+func checkTimers(ctx context.Context) {
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	lastCountdownPrint := time.Time{}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			mu.Lock()
+			skipped, err := waits.CheckTimeouts(now)
+			if err == nil {
+				// failures can depend on time too, e.g. pods that are unschedulable for too long
+				var skippedFailures bool
+				skippedFailures, err = waits.CheckFailures()
+				skipped = skipped || skippedFailures
+			}
+			stabilized := waits.UpdateStability(now)
+			if err != nil {
+				failWait(err)
+			} else if skipped || stabilized {
+				processChange(ctx)
+			} else if waits.IsCountingDown() && now.Sub(lastCountdownPrint) >= countdownPrintInterval {
+				waits.PrintStatus()
+				lastCountdownPrint = now
+			}
+			mu.Unlock()
+		}
+	}
+}
+
+// newCache creates the cache for the kubeconfig context of the cluster that only watches the given namespaces, and cluster-scoped resources.
+func newCache(cluster *pkg.Cluster, namespaces []string) (cache.Cache, error) {
+	configFlags := getConfigFlags(cluster.GetName())
+
+	conf, err := configFlags.ToRESTConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	mapper, err := configFlags.ToRESTMapper()
+	if err != nil {
+		return nil, err
+	}
+
+	nsConfigs := map[string]cache.Config{}
+
+	for _, ns := range namespaces {
+		nsConfigs[ns] = cache.Config{}
+	}
+
+	opts := cache.Options{
+		Mapper:            mapper,
+		DefaultNamespaces: nsConfigs,
+		SyncPeriod:        WaitForConfigFlags.SyncPeriod,
+		// informers that can not list or watch their kind (e.g. without permissions) would otherwise retry until the timeout
+		DefaultWatchErrorHandler: newWatchErrorHandler(cluster),
+	}
+
+	return cache.New(conf, opts)
+}
+
+// startCaches starts the caches of all clusters and blocks until all of them are stopped.
+func startCaches(ctx context.Context, clusters []*pkg.Cluster) error {
+	wg := sync.WaitGroup{}
+	errs := make([]error, len(clusters))
+
+	for i, cluster := range clusters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = cluster.Start(ctx)
+			if errs[i] != nil {
+				// one failing cluster fails the whole wait
+				cancelFn()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// waitForSync marks the kinds as synced once their event handlers have received the objects that existed when they were registered,
+// from then on items of those kinds that were not seen are known to not exist.
+func waitForSync(ctx context.Context, cluster *pkg.Cluster, gvks []schema.GroupVersionKind, synced []toolscache.InformerSynced) {
+	if !toolscache.WaitForCacheSync(ctx.Done(), synced...) {
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	cluster.SetSynced(gvks)
+	processChange(ctx)
+}
+
+// ensureEventHandlers registers the handlers for the kinds the active items of the cluster need that are not registered yet.
+// Informers for those kinds are started right away when the cache is already running.
+func ensureEventHandlers(ctx context.Context, cluster *pkg.Cluster) error {
+	gvks := cluster.NeedInformers()
+	if len(gvks) == 0 {
+		return nil
+	}
+
+	for _, gvk := range gvks {
+		registration, err := addEventHandler(ctx, cluster, gvk)
 		if err != nil {
 			return err
 		}
+		// every kind syncs on its own, an informer that can not sync (e.g. events without permissions) does not hold up the others
+		go waitForSync(ctx, cluster, []schema.GroupVersionKind{gvk}, []toolscache.InformerSynced{registration.HasSynced})
+	}
 
-		svc_informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+	return nil
+}
+
+// addEventHandler registers the handlers for a single kind, pods, services and jobs use typed informers and all other kinds unstructured ones.
+func addEventHandler(ctx context.Context, cluster *pkg.Cluster, gvk schema.GroupVersionKind) (toolscache.ResourceEventHandlerRegistration, error) {
+	switch gvk {
+	case pkg.ServiceGVK:
+		svc_informer, err := cluster.GetInformerForKind(ctx, gvk, cache.BlockUntilSynced(false))
+		if err != nil {
+			return nil, err
+		}
+
+		return svc_informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
 			AddFunc: func(obj interface{}) {
-				handleEvent(timeoutCtx, waits.ProcessEventAddService, obj.(*corev1.Service))
+				handleEvent(ctx, cluster, gvk, cluster.ProcessEventAddService, obj.(*corev1.Service))
 			},
 			UpdateFunc: func(obj interface{}, newObj interface{}) {
-				handleEvent(timeoutCtx, waits.ProcessEventUpdateService, newObj.(*corev1.Service))
+				handleEvent(ctx, cluster, gvk, cluster.ProcessEventUpdateService, newObj.(*corev1.Service))
 			},
 			DeleteFunc: func(obj interface{}) {
-				handleEvent(timeoutCtx, waits.ProcessEventDeleteService, obj.(*corev1.Service))
+				handleEvent(ctx, cluster, gvk, cluster.ProcessEventDeleteService, fromTombstone(obj).(*corev1.Service))
 			},
 		})
-	}
-
-	if waits.HasServices() || waits.HasPods() {
-		pod_informer, err := cc.GetInformerForKind(timeoutCtx, schema.FromAPIVersionAndKind("v1", "Pod"))
+	case pkg.PodGVK:
+		pod_informer, err := cluster.GetInformerForKind(ctx, gvk, cache.BlockUntilSynced(false))
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		pod_informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		return pod_informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
 			AddFunc: func(obj interface{}) {
-				handleEvent(timeoutCtx, waits.ProcessEventAddPod, obj.(*corev1.Pod))
+				handleEvent(ctx, cluster, gvk, cluster.ProcessEventAddPod, obj.(*corev1.Pod))
 			},
 			UpdateFunc: func(obj interface{}, newObj interface{}) {
-				handleEvent(timeoutCtx, waits.ProcessEventUpdatePod, newObj.(*corev1.Pod))
+				handleEvent(ctx, cluster, gvk, cluster.ProcessEventUpdatePod, newObj.(*corev1.Pod))
 			},
 			DeleteFunc: func(obj interface{}) {
-				handleEvent(timeoutCtx, waits.ProcessEventDeletePod, obj.(*corev1.Pod))
+				handleEvent(ctx, cluster, gvk, cluster.ProcessEventDeletePod, fromTombstone(obj).(*corev1.Pod))
 			},
 		})
-	}
+	case pkg.EventGVK:
+		event_informer, err := cluster.GetInformerForKind(ctx, gvk, cache.BlockUntilSynced(false))
+		if err != nil {
+			return nil, err
+		}
 
-	if waits.HasJobs() {
-		job_informer, err := cc.GetInformerForKind(timeoutCtx, schema.FromAPIVersionAndKind("batch/v1", "Job"))
+		// deleted events only expire, the latest warning of a pod stays relevant
+		return event_informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				handleEvent(ctx, cluster, gvk, cluster.ProcessEventAddWarning, obj.(*corev1.Event))
+			},
+			UpdateFunc: func(obj interface{}, newObj interface{}) {
+				handleEvent(ctx, cluster, gvk, cluster.ProcessEventUpdateWarning, newObj.(*corev1.Event))
+			},
+		})
+	case pkg.JobGVK:
+		job_informer, err := cluster.GetInformerForKind(ctx, gvk, cache.BlockUntilSynced(false))
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		job_informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		return job_informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
 			AddFunc: func(obj interface{}) {
-				handleEvent(timeoutCtx, waits.ProcessEventAddJob, obj.(*batchv1.Job))
+				handleEvent(ctx, cluster, gvk, cluster.ProcessEventAddJob, obj.(*batchv1.Job))
 			},
 			UpdateFunc: func(obj interface{}, newObj interface{}) {
-				handleEvent(timeoutCtx, waits.ProcessEventUpdateJob, newObj.(*batchv1.Job))
+				handleEvent(ctx, cluster, gvk, cluster.ProcessEventUpdateJob, newObj.(*batchv1.Job))
 			},
 			DeleteFunc: func(obj interface{}) {
-				handleEvent(timeoutCtx, waits.ProcessEventDeleteJob, obj.(*batchv1.Job))
+				handleEvent(ctx, cluster, gvk, cluster.ProcessEventDeleteJob, fromTombstone(obj).(*batchv1.Job))
 			},
 		})
 	}
 
-	err = cc.Start(timeoutCtx)
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	resource_informer, err := cluster.GetInformer(ctx, obj, cache.BlockUntilSynced(false))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	waits.Done()
+	return resource_informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			handleEvent(ctx, cluster, gvk, cluster.ProcessEventAddResource, obj.(*unstructured.Unstructured))
+		},
+		UpdateFunc: func(obj interface{}, newObj interface{}) {
+			handleEvent(ctx, cluster, gvk, cluster.ProcessEventUpdateResource, newObj.(*unstructured.Unstructured))
+		},
+		DeleteFunc: func(obj interface{}) {
+			handleEvent(ctx, cluster, gvk, cluster.ProcessEventDeleteResource, fromTombstone(obj).(*unstructured.Unstructured))
+		},
+	})
+}
 
-	return nil
+// fromTombstone returns the last known state of an object whose deletion was missed while the watch was disconnected.
+func fromTombstone(obj interface{}) interface{} {
+	if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+		return tombstone.Obj
+	}
+	return obj
+}
+
+// failWait stops waiting with the error, it needs to be called with mu held.
+func failWait(err error) {
+	if waitErr == nil {
+		waitErr = err
+	}
+	cancelFn()
 }
 
 func processCompletion() {
 	cancelFn()
 }
 
-func handleEvent[V *corev1.Pod | *corev1.Service | *batchv1.Job](ctx context.Context, f func(ctx context.Context, obj V) (bool, error), obj V) {
+// eventObject is any object that event handlers are registered for.
+type eventObject interface {
+	*corev1.Pod | *corev1.Service | *batchv1.Job | *corev1.Event | *unstructured.Unstructured
+	GetNamespace() string
+	GetName() string
+}
+
+// handleEvent processes the object with f, failures are retried, see processEvent.
+func handleEvent[V eventObject](ctx context.Context, cluster *pkg.Cluster, gvk schema.GroupVersionKind, f func(ctx context.Context, obj V) (bool, error), obj V) {
 	mu.Lock()
 	defer mu.Unlock()
 
-	matches, err := f(ctx, obj)
-	if err != nil {
-		log.Fatal(err)
-	}
+	key := retryKey{cluster: cluster, gvk: gvk, namespace: obj.GetNamespace(), name: obj.GetName()}
+	processEvent(ctx, key, func(ctx context.Context) (bool, error) {
+		return f(ctx, obj)
+	})
+}
+
+// processChange starts waiting for items whose dependencies are done, and completes the wait once everything is done.
+// It needs to be called with mu held after items changed.
+func processChange(ctx context.Context) {
+	// dependencies are only done when they are stable, and newly active items can be ready right away
+	waits.UpdateStability(time.Now())
 
-	if matches {
-		waits.PrintStatus()
+	// a failed optional item is skipped, which can be all that its dependents were waiting for
+	if _, err := waits.CheckFailures(); err != nil {
+		failWait(err)
+		return
+	}
 
-		if waits.IsDone() {
-			processCompletion()
+	for _, cluster := range waits.ActivateItems(time.Now()) {
+		if err := ensureEventHandlers(ctx, cluster); err != nil {
+			failWait(&pkg.APIError{Err: err})
+			return
 		}
 	}
+
+	waits.UpdateStability(time.Now())
+
+	if _, err := waits.CheckFailures(); err != nil {
+		failWait(err)
+		return
+	}
+
+	waits.PrintStatus()
+
+	if waits.IsDone() {
+		processCompletion()
+	}
 }
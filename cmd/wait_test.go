@@ -0,0 +1,136 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newForbiddenAPIServer serves the discovery of the core kinds and forbids everything else.
+func newForbiddenAPIServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var body interface{}
+		switch r.URL.Path {
+		case "/api":
+			body = metav1.APIVersions{TypeMeta: metav1.TypeMeta{Kind: "APIVersions"}, Versions: []string{"v1"}}
+		case "/apis":
+			body = metav1.APIGroupList{TypeMeta: metav1.TypeMeta{Kind: "APIGroupList", APIVersion: "v1"}}
+		case "/api/v1":
+			body = metav1.APIResourceList{
+				TypeMeta:     metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+				GroupVersion: "v1",
+				APIResources: []metav1.APIResource{
+					{Name: "pods", Kind: "Pod", Namespaced: true, Verbs: []string{"get", "list", "watch"}},
+					{Name: "services", Kind: "Service", Namespaced: true, Verbs: []string{"get", "list", "watch"}},
+					{Name: "events", Kind: "Event", Namespaced: true, Verbs: []string{"get", "list", "watch"}},
+				},
+			}
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			body = metav1.Status{
+				TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+				Status:   metav1.StatusFailure,
+				Reason:   metav1.StatusReasonForbidden,
+				Code:     http.StatusForbidden,
+				Details:  &metav1.StatusDetails{Kind: path.Base(r.URL.Path)},
+				Message:  fmt.Sprintf("%s is forbidden: User \"system:serviceaccount:default:wait\" cannot list resource \"%[1]s\" in API group \"\"", path.Base(r.URL.Path)),
+			}
+		}
+		if err := json.NewEncoder(w).Encode(body); err != nil {
+			t.Errorf("unable to write response: %v", err)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// writeKubeconfig writes a kubeconfig with the context test for the server into the directory and returns its path.
+func writeKubeconfig(t *testing.T, dir string, server string) string {
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	config := `apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: ` + server + `
+users:
+- name: test
+  user:
+    token: test
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+`
+	if err := os.WriteFile(kubeconfig, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return kubeconfig
+}
+
+func TestWaitForbiddenListExitsWithAPIError(t *testing.T) {
+	server := newForbiddenAPIServer(t)
+
+	dir := t.TempDir()
+	kubeconfig := writeKubeconfig(t, dir, server.URL)
+
+	rootCmd.SetArgs([]string{"--kubeconfig", kubeconfig, "--cache-dir", filepath.Join(dir, "cache"), "--timeout", "30s", "--error-retry-limit", "0", "default,pod,web"})
+	err := rootCmd.Execute()
+
+	if code := getExitCode(err); code != ExitCodeAPIError {
+		t.Fatalf("expected exit code %d, got %d (%v)", ExitCodeAPIError, code, err)
+	}
+}
+
+func TestWaitExitCodes(t *testing.T) {
+	server := newForbiddenAPIServer(t)
+
+	dir := t.TempDir()
+	kubeconfig := writeKubeconfig(t, dir, server.URL)
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{name: "unknown context", args: []string{"--timeout", "30s", "ctx=missing:default,pod,web"}, want: ExitCodeAPIError},
+		{name: "unknown context of a resource", args: []string{"--timeout", "30s", "ctx=missing:default,deployment,web"}, want: ExitCodeAPIError},
+		{name: "negative timeout", args: []string{"--timeout", "-1s", "default,pod,web"}, want: ExitCodeInvalidArgs},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rootCmd.SetArgs(append([]string{"--kubeconfig", kubeconfig, "--cache-dir", filepath.Join(dir, "cache")}, tt.args...))
+			err := rootCmd.Execute()
+
+			if code := getExitCode(err); code != tt.want {
+				t.Fatalf("expected exit code %d, got %d (%v)", tt.want, code, err)
+			}
+		})
+	}
+}
@@ -28,10 +28,28 @@ type ConfigFlags struct {
 	PrintVersion              *bool
 	PrintTree                 *bool
 	PrintCollapsedTree        *bool
+	Output                    *string
 	OnlyOnePerServiceRequired *bool
 
-	Timeout    *time.Duration
-	SyncPeriod *time.Duration
+	For    *string
+	Groups *[]string
+
+	Timeout        *time.Duration
+	SyncPeriod     *time.Duration
+	StableFor      *time.Duration
+	MissingTimeout *time.Duration
+
+	FailFast             *bool
+	FatalReasons         *[]string
+	RestartLimit         *int32
+	UnschedulableTimeout *time.Duration
+	WatchEvents          *bool
+	ErrorRetryLimit      *int
+	RequireNewJobs       *bool
+	JobMissing           *string
+
+	DiagnosticsDir      *string
+	DiagnosticsLogLines *int64
 }
 
 func NewConfigFlags() *ConfigFlags {
@@ -39,10 +57,28 @@ func NewConfigFlags() *ConfigFlags {
 		PrintVersion:              utilpointer.Bool(false),
 		PrintTree:                 utilpointer.Bool(true),
 		PrintCollapsedTree:        utilpointer.Bool(true),
+		Output:                    utilpointer.String("text"),
 		OnlyOnePerServiceRequired: utilpointer.Bool(false),
 
-		Timeout:    utilpointer.Duration(time.Duration(600 * time.Second)),
-		SyncPeriod: utilpointer.Duration(time.Duration(90 * time.Second)),
+		For:    utilpointer.String(""),
+		Groups: &[]string{},
+
+		Timeout:        utilpointer.Duration(time.Duration(600 * time.Second)),
+		SyncPeriod:     utilpointer.Duration(time.Duration(90 * time.Second)),
+		StableFor:      utilpointer.Duration(0),
+		MissingTimeout: utilpointer.Duration(0),
+
+		FailFast:             utilpointer.Bool(true),
+		FatalReasons:         &[]string{},
+		RestartLimit:         utilpointer.Int32(0),
+		UnschedulableTimeout: utilpointer.Duration(0),
+		WatchEvents:          utilpointer.Bool(false),
+		ErrorRetryLimit:      utilpointer.Int(5),
+		RequireNewJobs:       utilpointer.Bool(false),
+		JobMissing:           utilpointer.String("wait"),
+
+		DiagnosticsDir:      utilpointer.String(""),
+		DiagnosticsLogLines: utilpointer.Int64(100),
 	}
 }
 
@@ -55,8 +91,64 @@ func (f *ConfigFlags) AddFlags(flags *pflag.FlagSet) {
 		flags.DurationVar(f.SyncPeriod, "sync-period", *f.SyncPeriod, "The length of time to pass to the cache to initiate a sync. (e.g. 1s, 2m, 3h)")
 	}
 
+	if f.StableFor != nil {
+		flags.DurationVar(f.StableFor, "stable-for", *f.StableFor, "The length of time every item that does not have its own ;stable-for= option needs to stay done without interruption. (e.g. 30s)")
+	}
+
+	if f.MissingTimeout != nil {
+		flags.DurationVar(f.MissingTimeout, "missing-timeout", *f.MissingTimeout, "Fail when an item that does not have its own ;missing-timeout= option does not exist for that long once it is waited for. Zero disables it. (e.g. 1m)")
+	}
+
+	if f.FailFast != nil {
+		flags.BoolVar(f.FailFast, "fail-fast", *f.FailFast, "When true the wait fails as soon as an item that does not have its own ;fail-fast= option failed (e.g. a job that reached its backoffLimit). When false it keeps waiting, e.g. for jobs that are retried by hand.")
+	}
+
+	if f.FatalReasons != nil {
+		flags.StringSliceVar(f.FatalReasons, "fatal-reasons", *f.FatalReasons, "The container waiting or terminated reasons that fail pods that are not ready, for every pod, service and owner that does not have its own ;fatal-reasons= option. (e.g. CrashLoopBackOff,ImagePullBackOff,ErrImagePull,CreateContainerConfigError)")
+	}
+
+	if f.RestartLimit != nil {
+		flags.Int32Var(f.RestartLimit, "restart-limit", *f.RestartLimit, "Fail pods that are not ready when one of their containers restarted that many times, for every pod, service and owner that does not have its own ;restart-limit= option. Zero disables the limit.")
+	}
+
+	if f.UnschedulableTimeout != nil {
+		flags.DurationVar(f.UnschedulableTimeout, "unschedulable-timeout", *f.UnschedulableTimeout, "Fail pods that could not be scheduled for that long, for every pod, service and owner that does not have its own ;unschedulable-timeout= option. Zero disables it. (e.g. 5m)")
+	}
+
+	if f.ErrorRetryLimit != nil {
+		flags.IntVar(f.ErrorRetryLimit, "error-retry-limit", *f.ErrorRetryLimit, "How often processing an object, or listing and watching a kind, is retried after a persistent API error (e.g. forbidden) before the wait fails with exit code 4. Other errors are retried until the timeout.")
+	}
+
+	if f.RequireNewJobs != nil {
+		flags.BoolVar(f.RequireNewJobs, "require-new-jobs", *f.RequireNewJobs, "Only count jobs that were created after the wait started, for every job that does not have its own ;require-new= option. Older jobs are shown as outdated until they are created again (e.g. by Helm).")
+	}
+
+	if f.JobMissing != nil {
+		flags.StringVar(f.JobMissing, "job-missing", *f.JobMissing, "What it means when a job that does not have its own ;job-missing= option does not exist, e.g. because it was removed by its ttlSecondsAfterFinished: complete, wait or fail.")
+	}
+
+	if f.DiagnosticsDir != nil {
+		flags.StringVar(f.DiagnosticsDir, "diagnostics-dir", *f.DiagnosticsDir, "The directory to write the objects, pod statuses, Events and logs of the items that are not done to when the wait fails or times out, with an index.yaml that lists them. Empty disables it.")
+	}
+
+	if f.DiagnosticsLogLines != nil {
+		flags.Int64Var(f.DiagnosticsLogLines, "diagnostics-log-lines", *f.DiagnosticsLogLines, "The number of log lines of every container that is not ready to write to --diagnostics-dir, zero writes all of them.")
+	}
+
+	if f.WatchEvents != nil {
+		flags.BoolVar(f.WatchEvents, "watch-events", *f.WatchEvents, "Watch the Events of pods to show their latest warning (e.g. FailedScheduling), this needs list and watch permissions on events.")
+	}
+
 	if f.OnlyOnePerServiceRequired != nil {
-		flags.BoolVar(f.OnlyOnePerServiceRequired, "only-one-per-service-required", *f.OnlyOnePerServiceRequired, "When true a service is ready when at least one pod is ready. When false all pods must be ready.")
+		flags.BoolVar(f.OnlyOnePerServiceRequired, "only-one-per-service-required", *f.OnlyOnePerServiceRequired, "When true a service, owner or label selector is ready when at least one pod is ready, the same as ;min=1 on every such item. When false all pods must be ready.")
+	}
+
+	if f.For != nil {
+		flags.StringVar(f.For, "for", *f.For, "The condition to wait for on every item that does not have its own ;for= option, instead of the default readiness check of its kind. (e.g. jsonpath='{.status.phase}'=Running, cel='self.status.phase == \"Running\"' delete or complete)")
+	}
+
+	if f.Groups != nil {
+		flags.StringArrayVar(f.Groups, "group", *f.Groups, "A group in the form NAME=MODE that is done when all, any or quorum:N of its members are done, add items to it with the ;group=NAME option. Groups can be nested with NAME=MODE;group=PARENT. (e.g. etcd=quorum:2)")
 	}
 
 	if f.PrintVersion != nil {
@@ -70,4 +162,8 @@ func (f *ConfigFlags) AddFlags(flags *pflag.FlagSet) {
 	if f.PrintCollapsedTree != nil {
 		flags.BoolVar(f.PrintCollapsedTree, "print-collapsed-tree", *f.PrintCollapsedTree, "Collapse the status tree for done subtrees")
 	}
+
+	if f.Output != nil {
+		flags.StringVarP(f.Output, "output", "o", *f.Output, "What to write to stdout next to the log output on stderr: text writes nothing, json writes a summary when the wait ends and ndjson writes a line for every change of an item followed by the summary.")
+	}
 }
@@ -0,0 +1,513 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package pkg
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/erayan/k8s-wait-for-multi/pkg/items"
+
+	"github.com/xlab/treeprint"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+var (
+	ServiceGVK = schema.FromAPIVersionAndKind("v1", "Service")
+	PodGVK     = schema.FromAPIVersionAndKind("v1", "Pod")
+	JobGVK     = schema.FromAPIVersionAndKind("batch/v1", "Job")
+	// DeploymentGVK is watched for the rollout failures of the deployments behind services.
+	DeploymentGVK = schema.FromAPIVersionAndKind("apps/v1", "Deployment")
+	// EventGVK is watched for the warnings of pods, e.g. FailedScheduling.
+	EventGVK = schema.FromAPIVersionAndKind("v1", "Event")
+)
+
+// Cluster holds the cache and all items to wait for in a single kubeconfig context.
+type Cluster struct {
+	cache.Cache
+
+	name string
+
+	// watchEvents enables watching the warning Events of pods.
+	watchEvents bool
+	// podWarnings holds the latest warning Event of every pod, keyed by the uid of the pod.
+	podWarnings map[types.UID]podWarning
+
+	LastPodEvents map[types.UID]Event
+
+	Services items.NamespacedServiceCollection
+	Pods     items.NamespacedPodCollection
+	Jobs     items.NamespacedJobCollection
+	Owners   items.NamespacedOwnerCollection
+
+	// Selectors holds the pod targets that are given as a label selector instead of a name.
+	Selectors items.NamespacedSelectorCollection
+
+	// Resources holds all other kinds, including cluster-scoped ones.
+	Resources items.NamespacedResourceCollection
+
+	failedOwnerKinds map[schema.GroupVersionKind]error
+	// failedWorkloadLookup is set when the deployments behind services can not be looked up, e.g. because of missing permissions.
+	failedWorkloadLookup bool
+
+	// informers holds the kinds for which event handlers are registered.
+	informers map[schema.GroupVersionKind]bool
+	// watchErrors holds the persistent errors of the informers that can not list or watch their kind, e.g. because of missing permissions.
+	watchErrors map[schema.GroupVersionKind]error
+
+	// states holds what is tracked for every item independent of its kind.
+	states map[itemRef]*itemState
+}
+
+// addTarget adds the item of the target and returns a reference to it, startedAt is when the wait started.
+// Jobs are tracked by their uid, with ;require-new jobs that were created before startedAt are outdated.
+func (c *Cluster) addTarget(t *Target, startedAt time.Time) (itemRef, error) {
+	ref := itemRef{Kind: t.Kind, Namespace: t.Namespace, Name: t.Name}
+	switch t.Kind {
+	case "pod":
+		if t.Selector != nil {
+			ref.Kind = itemKindSelector
+			ref.Name = c.addSelector(t.Namespace, t.Selector).WithCondition(t.Condition).WithThreshold(t.Min).WithFailureRules(t.FailureRules).GetName()
+		} else {
+			pod := c.addPod(t.Namespace, t.Name, t.Container).WithCondition(t.Condition).WithFailureRules(t.FailureRules)
+			if t.Container != "" {
+				pod.WithContainer(t.Container, t.ContainerCondition)
+				ref.Name = items.PodKey(t.Name, t.Container)
+			}
+		}
+	case "job":
+		job := c.addJob(t.Namespace, t.Name).WithCondition(t.Condition).WithMissingPolicy(t.JobMissing).WithIndexes(t.Indexes)
+		if t.RequireNew {
+			job.WithNotBefore(startedAt)
+		}
+	case "service":
+		c.addService(t.Namespace, t.Name).WithCondition(t.Condition).WithThreshold(t.Min).WithFailureRules(t.FailureRules)
+	case "owner":
+		owner, err := c.addOwner(t.Namespace, t.Name)
+		if err != nil {
+			return ref, err
+		}
+		ref.Name = owner.WithThreshold(t.Min).WithFailureRules(t.FailureRules).GetName()
+	default:
+		if t.GroupVersionKind.Empty() {
+			return ref, fmt.Errorf("unsupported kind '%s'", t.Kind)
+		}
+		ref.Kind = itemKindResource
+		ref.Name = c.addResource(t.Namespace, t.Name, t.GroupVersionKind).WithCondition(t.Condition).GetKey()
+	}
+
+	state := c.getState(ref)
+	state.timeout = t.Timeout
+	state.missingTimeout = t.MissingTimeout
+	state.optional = t.Optional
+	state.waitOnFailure = t.WaitOnFailure
+	state.after = t.After
+	state.stableFor = t.StableFor
+	return ref, nil
+}
+
+func (c *Cluster) addPod(namespace string, name string, container string) *items.PodItem {
+	key := items.PodKey(name, container)
+	c.Pods.EnsureNamespace(namespace)
+	if !c.Pods.ContainsNamespacedName(namespace, key) {
+		c.Pods[namespace][key] = items.Pod(namespace, name)
+	}
+	return c.Pods[namespace][key]
+}
+
+func (c *Cluster) addService(namespace string, name string) *items.ServiceItem {
+	c.Services.EnsureNamespace(namespace)
+	if !c.Services.ContainsNamespacedName(namespace, name) {
+		c.Services[namespace][name] = items.Service(namespace, name)
+	}
+	return c.Services[namespace][name]
+}
+
+func (c *Cluster) addJob(namespace string, name string) *items.JobItem {
+	c.Jobs.EnsureNamespace(namespace)
+	if !c.Jobs.ContainsNamespacedName(namespace, name) {
+		c.Jobs[namespace][name] = items.Job(namespace, name)
+	}
+	return c.Jobs[namespace][name]
+}
+
+func (c *Cluster) addOwner(namespace string, ref string) (*items.OwnerItem, error) {
+	owner, err := items.Owner(namespace, ref)
+	if err != nil {
+		return nil, err
+	}
+	c.Owners.EnsureNamespace(namespace)
+	if !c.Owners.ContainsNamespacedName(namespace, owner.GetName()) {
+		c.Owners[namespace][owner.GetName()] = owner
+	}
+	return c.Owners[namespace][owner.GetName()], nil
+}
+
+func (c *Cluster) addSelector(namespace string, selector labels.Selector) *items.SelectorItem {
+	item := items.Selector(namespace, selector)
+	c.Selectors.EnsureNamespace(namespace)
+	if !c.Selectors.ContainsNamespacedName(namespace, item.GetName()) {
+		c.Selectors[namespace][item.GetName()] = item
+	}
+	return c.Selectors[namespace][item.GetName()]
+}
+
+func (c *Cluster) addResource(namespace string, name string, gvk schema.GroupVersionKind) *items.ResourceItem {
+	key := items.ResourceKey(gvk, name)
+	c.Resources.EnsureNamespace(namespace)
+	if !c.Resources.ContainsNamespacedName(namespace, key) {
+		c.Resources[namespace][key] = items.Resource(namespace, name, gvk)
+	}
+	return c.Resources[namespace][key]
+}
+
+func (c *Cluster) HasPodDirect(meta metav1.ObjectMeta) bool {
+	return len(c.Pods.GetForPod(&meta)) > 0
+}
+
+func (c *Cluster) HasPod(meta metav1.ObjectMeta) bool {
+	return c.HasPodDirect(meta) || c.Services.ContainsPod(&meta) || c.Owners.ContainsPod(&meta) || c.Selectors.ContainsPod(&meta)
+}
+
+func (c *Cluster) HasService(meta metav1.ObjectMeta) bool {
+	return c.Services.Contains(&meta)
+}
+
+func (c *Cluster) HasJob(meta metav1.ObjectMeta) bool {
+	return c.Jobs.Contains(&meta)
+}
+
+func (c *Cluster) HasResource(obj *unstructured.Unstructured) bool {
+	_, ok := c.Resources.Get(obj)
+	return ok
+}
+
+// IsDone returns true when all items that are not part of a group are done.
+func (c *Cluster) IsDone() bool {
+	for _, ref := range c.itemRefs() {
+		if !c.isGrouped(ref) && !c.isItemDone(ref) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Cluster) SetPodReadyFromPod(pod *corev1.Pod) {
+	for _, item := range c.Pods.GetForPod(pod) {
+		item.WithReadyFromPod(pod)
+	}
+}
+
+func (c *Cluster) UnsetPodReady(pod *corev1.Pod) {
+	for _, item := range c.Pods.GetForPod(pod) {
+		item.WithAbsent()
+	}
+}
+
+// SetJobCompleteFromJob updates the job item, when the job was deleted and created again (e.g. by Helm) the stability of the previous run is forgotten.
+func (c *Cluster) SetJobCompleteFromJob(job *batchv1.Job) {
+	item := c.Jobs[job.Namespace][job.Name]
+	if uid := item.GetUID(); uid != "" && uid != job.UID {
+		log.Printf("Job %s/%s was created again, waiting for the new run", job.Namespace, job.Name)
+		c.resetStability(itemRef{Kind: itemKindJob, Namespace: job.Namespace, Name: job.Name})
+	}
+	item.WithCompleteFromJob(job)
+}
+
+// UnsetJobComplete marks the job as deleted, unless a newer job with the same name was already seen.
+// A deleted job that was seen complete stays complete.
+func (c *Cluster) UnsetJobComplete(job *batchv1.Job) {
+	item := c.Jobs[job.Namespace][job.Name]
+	if uid := item.GetUID(); uid != "" && job.UID != "" && uid != job.UID {
+		return
+	}
+	item.WithDeleted(job.UID)
+}
+
+func (c *Cluster) SetResourceReadyFromObject(obj *unstructured.Unstructured) {
+	if item, ok := c.Resources.Get(obj); ok {
+		item.WithReadyFromObject(obj)
+	}
+}
+
+func (c *Cluster) UnsetResourceReady(obj *unstructured.Unstructured) {
+	if item, ok := c.Resources.Get(obj); ok {
+		item.WithAbsent()
+	}
+}
+
+func (c *Cluster) SetServiceChildren(meta *metav1.ObjectMeta, pods []corev1.Pod) {
+	svc := c.Services[meta.Namespace][meta.Name]
+	podItems := items.PodCollection{}
+	for _, pod := range pods {
+		podItems[pod.Name] = items.Pod(pod.Namespace, pod.Name).WithFailureRules(svc.GetFailureRules()).WithReadyFromPod(&pod)
+	}
+	svc.WithChildren(podItems)
+}
+
+// SetPodOwners adds the pod as a child to all given owners in its namespace and removes it from the others.
+// It returns true when the pod is or was a child of any of the owners in its namespace.
+func (c *Cluster) SetPodOwners(pod *corev1.Pod, owners []*items.OwnerItem) bool {
+	changed := false
+	for _, owner := range c.Owners[pod.Namespace] {
+		podItem, isChild := owner.GetPod(pod)
+		if slices.Contains(owners, owner) {
+			if isChild {
+				podItem.WithReadyFromPod(pod)
+			} else {
+				owner.WithChild(items.Pod(pod.Namespace, pod.Name).WithFailureRules(owner.GetFailureRules()).WithReadyFromPod(pod))
+			}
+			changed = true
+		} else if isChild {
+			owner.DeletePod(pod)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// SetPodSelectors adds or updates the pod as a child of all selectors in its namespace that match it, and removes it from the others.
+// It returns true when the pod is or was a child of any of the selectors.
+func (c *Cluster) SetPodSelectors(pod *corev1.Pod) bool {
+	changed := false
+	for _, selector := range c.Selectors[pod.Namespace] {
+		if selector.Matches(pod) || selector.GetChildren().ContainsName(pod.Name) {
+			changed = true
+		}
+		selector.WithPod(pod)
+	}
+	return changed
+}
+
+// SetObjectError records why the object could not be processed on the items that wait for it, the empty string clears it.
+func (c *Cluster) SetObjectError(gvk schema.GroupVersionKind, namespace string, name string, err string) {
+	for _, ref := range c.itemRefs() {
+		if ref.Namespace == namespace && c.isItemObject(ref, gvk, name) {
+			c.getState(ref).err = err
+		}
+	}
+}
+
+// SetSynced is called once the informers of the given kinds have delivered all objects that existed when they were started.
+// Items of those kinds that have not been seen by then do not exist.
+func (c *Cluster) SetSynced(gvks []schema.GroupVersionKind) {
+	if slices.Contains(gvks, ServiceGVK) {
+		for _, nsitems := range c.Services {
+			for _, val := range nsitems {
+				if !val.IsObserved() {
+					val.WithConditionFromService(nil)
+				}
+			}
+		}
+	}
+	if slices.Contains(gvks, PodGVK) {
+		for _, nsitems := range c.Pods {
+			for _, val := range nsitems {
+				if !val.IsObserved() {
+					val.WithAbsent()
+				}
+			}
+		}
+		for _, nsitems := range c.Selectors {
+			for _, val := range nsitems {
+				val.WithSynced(true)
+			}
+		}
+	}
+	if slices.Contains(gvks, JobGVK) {
+		for _, nsitems := range c.Jobs {
+			for _, val := range nsitems {
+				if !val.IsObserved() {
+					val.WithAbsent()
+				}
+			}
+		}
+	}
+	for _, nsitems := range c.Resources {
+		for _, val := range nsitems {
+			if !val.IsObserved() && slices.Contains(gvks, val.GetGroupVersionKind()) {
+				val.WithAbsent()
+			}
+		}
+	}
+}
+
+// NeedInformers returns the kinds for which the active items need an informer that is not registered yet,
+// and marks those as registered.
+func (c *Cluster) NeedInformers() []schema.GroupVersionKind {
+	gvks := []schema.GroupVersionKind{}
+	need := func(gvk schema.GroupVersionKind) {
+		if !c.informers[gvk] && !slices.Contains(gvks, gvk) {
+			gvks = append(gvks, gvk)
+		}
+	}
+
+	for _, ref := range c.itemRefs() {
+		if !c.getState(ref).active {
+			continue
+		}
+		switch ref.Kind {
+		case itemKindService:
+			need(ServiceGVK)
+			need(PodGVK)
+			if !c.failedWorkloadLookup {
+				need(DeploymentGVK)
+			}
+			if c.watchEvents {
+				need(EventGVK)
+			}
+		case itemKindPod, itemKindOwner, itemKindSelector:
+			need(PodGVK)
+			if c.watchEvents {
+				need(EventGVK)
+			}
+		case itemKindJob:
+			need(JobGVK)
+		case itemKindResource:
+			need(c.Resources[ref.Namespace][ref.Name].GetGroupVersionKind())
+		}
+	}
+
+	for _, gvk := range gvks {
+		c.informers[gvk] = true
+	}
+	return gvks
+}
+
+func (c *Cluster) SetServiceConditionFromService(meta *metav1.ObjectMeta, svc *corev1.Service) {
+	c.Services[meta.Namespace][meta.Name].WithConditionFromService(svc)
+}
+
+func (c *Cluster) SetServiceExternality(meta *metav1.ObjectMeta, isExternal bool) {
+	c.Services[meta.Namespace][meta.Name].WithExternal(isExternal)
+}
+
+func (c *Cluster) TotalCount() int {
+	return c.Services.TotalCount() + c.Pods.TotalCount() + c.Jobs.TotalCount() + c.Owners.TotalCount() + c.Selectors.TotalCount() + c.Resources.TotalCount()
+}
+
+func (c *Cluster) WithCache(cc cache.Cache) *Cluster {
+	c.Cache = cc
+	return c
+}
+
+// SetWatchError records the persistent error (e.g. forbidden) of the informer of the kind, lookups of the kind return it
+// until the informer synced. It returns whether the items need the kind, kinds that are only looked up to discover
+// more about the items (e.g. the owners of pods) turn off that discovery instead.
+func (c *Cluster) SetWatchError(gvk schema.GroupVersionKind, err error) bool {
+	c.watchErrors[gvk] = err
+	if gvk == DeploymentGVK {
+		// the Deployments behind services are only watched for their rollout failures
+		return c.hasResourcesOfKind(gvk)
+	}
+	return c.informers[gvk]
+}
+
+// hasResourcesOfKind returns true when any of the items is an object of the kind.
+func (c *Cluster) hasResourcesOfKind(gvk schema.GroupVersionKind) bool {
+	for _, resources := range c.Resources {
+		for _, resource := range resources {
+			if resource.GetGroupVersionKind() == gvk {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetName returns the name of the kubeconfig context, the empty string is the current context.
+func (c *Cluster) GetName() string {
+	return c.name
+}
+
+// hasUngroupedItems returns true when any item is not part of a group, grouped items are shown in their group.
+func (c *Cluster) hasUngroupedItems() bool {
+	for _, ref := range c.itemRefs() {
+		if !c.isGrouped(ref) {
+			return true
+		}
+	}
+	return false
+}
+
+// getStatusItems returns all items that are not done yet in the form NAMESPACE/KIND/NAME, items in groups are left out.
+func (c *Cluster) getStatusItems() []string {
+	items := []string{}
+	for _, ref := range c.itemRefs() {
+		if c.isGrouped(ref) || c.isItemDone(ref) {
+			continue
+		}
+		if ref.Namespace == "" {
+			items = append(items, c.getItemName(ref))
+		} else {
+			items = append(items, fmt.Sprintf("%s/%s", ref.Namespace, c.getItemName(ref)))
+		}
+	}
+	return items
+}
+
+// addStatusTree adds a branch for every namespace (and one for cluster-scoped resources) to the tree, items in groups are left out.
+func (c *Cluster) addStatusTree(tree treeprint.Tree) {
+	namespace_branches := map[string]treeprint.Tree{}
+
+	for _, ref := range c.itemRefs() {
+		if c.isGrouped(ref) {
+			continue
+		}
+		branch, ok := namespace_branches[ref.Namespace]
+		if !ok {
+			if ref.Namespace == "" {
+				branch = tree.AddMetaBranch(TreeStatusUnknown, "cluster")
+			} else {
+				branch = tree.AddMetaBranch(TreeStatusUnknown, fmt.Sprintf("namespace/%s", ref.Namespace))
+			}
+			namespace_branches[ref.Namespace] = branch
+		}
+		c.addItemNode(branch, ref, c.getItemName(ref))
+	}
+}
+
+func newCluster(name string, watchEvents bool) *Cluster {
+	return &Cluster{
+		name:        name,
+		watchEvents: watchEvents,
+		podWarnings: map[types.UID]podWarning{},
+
+		LastPodEvents: map[types.UID]Event{},
+		Services:      items.NamespacedServiceCollection{},
+		Pods:          items.NamespacedPodCollection{},
+		Jobs:          items.NamespacedJobCollection{},
+		Owners:        items.NamespacedOwnerCollection{},
+		Selectors:     items.NamespacedSelectorCollection{},
+		Resources:     items.NamespacedResourceCollection{},
+
+		failedOwnerKinds: map[schema.GroupVersionKind]error{},
+		informers:        map[schema.GroupVersionKind]bool{},
+		watchErrors:      map[schema.GroupVersionKind]error{},
+		states:           map[itemRef]*itemState{},
+	}
+}
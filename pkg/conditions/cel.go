@@ -0,0 +1,105 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package conditions
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+type celCondition struct {
+	input      string
+	expression string
+	program    cel.Program
+}
+
+// newCELCondition compiles the expression, in which self is the object as it would be returned by the API.
+func newCELCondition(input string) (*celCondition, error) {
+	expression := strings.TrimSpace(trimQuotes(input))
+	if expression == "" {
+		return nil, errors.New("cel condition format must be cel='self.status.readyReplicas >= self.spec.replicas'")
+	}
+
+	env, err := cel.NewEnv(
+		cel.Variable("self", cel.DynType),
+		ext.Strings(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("invalid cel expression: %w", issues.Err())
+	}
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return nil, fmt.Errorf("cel expression must evaluate to a bool, got %s", ast.OutputType())
+	}
+
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+
+	return &celCondition{
+		input:      input,
+		expression: expression,
+		program:    program,
+	}, nil
+}
+
+// Evaluate returns an error when the expression fails, e.g. because a field it uses does not exist (yet), or is not a bool.
+func (c *celCondition) Evaluate(obj runtime.Object) (bool, string, error) {
+	content, err := toUnstructuredContent(obj)
+	if err != nil {
+		return false, "", err
+	}
+
+	val, _, err := c.program.Eval(map[string]interface{}{"self": content})
+	if err != nil {
+		return false, "", err
+	}
+
+	met, ok := val.Value().(bool)
+	if !ok {
+		return false, "", fmt.Errorf("expression returned %v instead of a bool", val.Value())
+	}
+
+	return met, fmt.Sprintf("%t", met), nil
+}
+
+// trimQuotes removes one pair of matching quotes around the input, quotes within the expression are kept.
+func trimQuotes(input string) string {
+	if len(input) >= 2 && (input[0] == '\'' || input[0] == '"') && input[len(input)-1] == input[0] {
+		return input[1 : len(input)-1]
+	}
+	return input
+}
+
+func (c *celCondition) Describe(current string) string {
+	return fmt.Sprintf("%s is %s", c.expression, current)
+}
+
+func (c *celCondition) String() string {
+	return "cel=" + c.input
+}
@@ -0,0 +1,105 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package conditions
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestParseCEL(t *testing.T) {
+	tests := []struct {
+		input      string
+		expression string
+		err        bool
+	}{
+		{input: "cel='self.status.readyReplicas >= self.spec.replicas'", expression: "self.status.readyReplicas >= self.spec.replicas"},
+		{input: `cel="self.status.phase == 'Running'"`, expression: "self.status.phase == 'Running'"},
+		{input: "cel=self.status.phase == 'Running'", expression: "self.status.phase == 'Running'"},
+		{input: "CEL=' self.spec.paused '", expression: "self.spec.paused"},
+		{input: "cel='self.metadata.name.startsWith(\"web\")'", expression: `self.metadata.name.startsWith("web")`},
+		{input: "cel=''", err: true},
+		{input: "cel=", err: true},
+		{input: "cel='self.status.readyReplicas >='", err: true},
+		{input: "cel='1 + 2'", err: true},
+		{input: "cel='unknown.field'", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			condition, err := Parse(tt.input)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", condition)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			c, ok := condition.(*celCondition)
+			if !ok {
+				t.Fatalf("expected a cel condition, got %T", condition)
+			}
+			if c.expression != tt.expression {
+				t.Errorf("got expression %q, want %q", c.expression, tt.expression)
+			}
+		})
+	}
+}
+
+func TestEvaluateCEL(t *testing.T) {
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "web"},
+		"spec":     map[string]interface{}{"replicas": int64(3)},
+		"status":   map[string]interface{}{"readyReplicas": int64(2)},
+	}}
+
+	tests := []struct {
+		input string
+		met   bool
+		err   bool
+	}{
+		{input: "cel='self.status.readyReplicas >= self.spec.replicas'", met: false},
+		{input: "cel='self.status.readyReplicas >= 2'", met: true},
+		{input: "cel='self.metadata.name.startsWith(\"we\")'", met: true},
+		{input: "cel='has(self.status.availableReplicas)'", met: false},
+		{input: "cel='self.status.availableReplicas > 0'", err: true},
+		{input: "cel='self.spec.replicas'", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			condition, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			met, _, err := condition.Evaluate(deployment)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", met)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if met != tt.met {
+				t.Errorf("got %v, want %v", met, tt.met)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package conditions
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/erayan/k8s-wait-for-multi/utils"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// completeCondition is met when a pod reached phase Succeeded or a job is Complete, it fails when they failed.
+type completeCondition struct{}
+
+// Complete is the condition used by --for=complete and the :succeeded pod mode.
+var Complete Condition = completeCondition{}
+
+func (c completeCondition) Evaluate(obj runtime.Object) (bool, string, error) {
+	switch o := obj.(type) {
+	case *corev1.Pod:
+		return o.Status.Phase == corev1.PodSucceeded, describePodPhase(o), nil
+	case *batchv1.Job:
+		if utils.IsJobStatusConditionTrue(o.Status.Conditions, batchv1.JobComplete) {
+			return true, "Complete", nil
+		}
+		if reason := c.Failure(o); reason != "" {
+			return false, reason, nil
+		}
+		return false, "Running", nil
+	case *unstructured.Unstructured:
+		return false, "", fmt.Errorf("complete is only supported for pods and jobs, not for %s", o.GetKind())
+	}
+	return false, "", fmt.Errorf("complete is not supported for %T", obj)
+}
+
+// Failure returns the reason when a pod reached phase Failed or a job has the Failed or FailureTarget condition.
+func (c completeCondition) Failure(obj runtime.Object) string {
+	switch o := obj.(type) {
+	case *corev1.Pod:
+		if o.Status.Phase == corev1.PodFailed {
+			return describePodPhase(o)
+		}
+	case *batchv1.Job:
+		return utils.GetJobFailure(o)
+	}
+	return ""
+}
+
+func (c completeCondition) Describe(current string) string {
+	return current
+}
+
+func (c completeCondition) String() string {
+	return "complete"
+}
+
+// describePodPhase returns the phase of the pod together with the exit codes of its terminated containers,
+// e.g. Failed (migrate exited with 1: Error).
+func describePodPhase(pod *corev1.Pod) string {
+	terminated := []string{}
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if status.State.Terminated == nil {
+			continue
+		}
+		// succeeded init containers are expected, only failed ones are interesting
+		if status.State.Terminated.ExitCode == 0 && pod.Status.Phase != corev1.PodSucceeded && isInitContainer(pod, status.Name) {
+			continue
+		}
+		terminated = append(terminated, fmt.Sprintf("%s exited with %d: %s", status.Name, status.State.Terminated.ExitCode, status.State.Terminated.Reason))
+	}
+
+	phase := string(pod.Status.Phase)
+	if phase == "" {
+		phase = string(corev1.PodPending)
+	}
+	if len(terminated) == 0 {
+		return phase
+	}
+	return fmt.Sprintf("%s (%s)", phase, strings.Join(terminated, ", "))
+}
+
+func isInitContainer(pod *corev1.Pod, name string) bool {
+	for _, container := range pod.Spec.InitContainers {
+		if container.Name == name {
+			return true
+		}
+	}
+	return false
+}
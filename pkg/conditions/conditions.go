@@ -0,0 +1,81 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package conditions
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Condition is a custom readiness check that is evaluated against every version of an object.
+type Condition interface {
+	// Evaluate returns whether the condition is met and the current value of the checked field(s).
+	Evaluate(obj runtime.Object) (bool, string, error)
+	// Describe returns a short human readable description of the condition and the current value.
+	Describe(current string) string
+	// String returns the condition in the form it was given.
+	String() string
+}
+
+// Failable is implemented by conditions that can tell when an object reached a state from which they can not be met anymore.
+type Failable interface {
+	// Failure returns the reason the condition can not be met anymore, or the empty string.
+	Failure(obj runtime.Object) string
+}
+
+// ReplacesStatus returns true for conditions that describe the whole state of an object, like delete and complete,
+// their description is shown instead of the status of the item.
+func ReplacesStatus(c Condition) bool {
+	switch c.(type) {
+	case deleteCondition, completeCondition:
+		return true
+	}
+	return false
+}
+
+// Parse parses a condition in the form accepted by --for, e.g. jsonpath='{.status.phase}'=Running, cel='self.spec.replicas == 0', complete or delete.
+func Parse(input string) (Condition, error) {
+	kind, value, _ := strings.Cut(input, "=")
+	switch strings.ToLower(kind) {
+	case "delete":
+		if value != "" {
+			return nil, fmt.Errorf("delete condition does not take a value: '%s'", input)
+		}
+		return Delete, nil
+	case "complete":
+		if value != "" {
+			return nil, fmt.Errorf("complete condition does not take a value: '%s'", input)
+		}
+		return Complete, nil
+	case "cel":
+		return newCELCondition(value)
+	case "jsonpath":
+		return newJSONPathCondition(value)
+	}
+	return nil, fmt.Errorf("unrecognized condition: '%s'", input)
+}
+
+// toUnstructuredContent returns the content of typed and unstructured objects alike.
+func toUnstructuredContent(obj runtime.Object) (map[string]interface{}, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u.UnstructuredContent(), nil
+	}
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+}
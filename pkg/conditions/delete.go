@@ -0,0 +1,60 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package conditions
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// deleteCondition is met once the object does not exist anymore, it is never met by an existing object.
+type deleteCondition struct{}
+
+// Delete is the condition used by --for=delete.
+var Delete Condition = deleteCondition{}
+
+// IsDelete returns true when the condition waits for the deletion of the object.
+func IsDelete(c Condition) bool {
+	_, ok := c.(deleteCondition)
+	return ok
+}
+
+// Evaluate reports a terminating object together with the finalizers that are holding it.
+func (c deleteCondition) Evaluate(obj runtime.Object) (bool, string, error) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return false, "", err
+	}
+	if accessor.GetDeletionTimestamp() == nil {
+		return false, "Exists", nil
+	}
+	if len(accessor.GetFinalizers()) == 0 {
+		return false, "Terminating", nil
+	}
+	return false, fmt.Sprintf("Terminating (finalizers: %s)", strings.Join(accessor.GetFinalizers(), ", ")), nil
+}
+
+func (c deleteCondition) Describe(current string) string {
+	return current
+}
+
+func (c deleteCondition) String() string {
+	return "delete"
+}
@@ -0,0 +1,141 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package conditions
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/jsonpath"
+	kubectlget "k8s.io/kubectl/pkg/cmd/get"
+)
+
+// Adapted from https://github.com/kubernetes/kubectl/blob/master/pkg/cmd/wait/json.go
+
+type jsonPathCondition struct {
+	input      string
+	expression string
+	value      string
+	matchAny   bool
+	parser     *jsonpath.JSONPath
+}
+
+// newJSONPathCondition parses the input in the form '{.status.readyReplicas}'=3 or '{.status.readyReplicas}'.
+// Without a value the condition is met as soon as the field exists.
+func newJSONPathCondition(input string) (*jsonPathCondition, error) {
+	parts := splitJSONPathInput(input)
+	if len(parts) < 1 || len(parts) > 2 {
+		return nil, errors.New("jsonpath condition format must be jsonpath='{.status.readyReplicas}'=3 or jsonpath='{.status.readyReplicas}'")
+	}
+
+	expression, err := kubectlget.RelaxedJSONPathExpression(strings.Trim(parts[0], `'"`))
+	if err != nil {
+		return nil, err
+	}
+	if expression == "" {
+		return nil, errors.New("jsonpath expression cannot be empty")
+	}
+
+	parser := jsonpath.New("wait").AllowMissingKeys(true)
+	if err := parser.Parse(expression); err != nil {
+		return nil, err
+	}
+
+	c := &jsonPathCondition{
+		input:      input,
+		expression: expression,
+		parser:     parser,
+		matchAny:   len(parts) == 1,
+	}
+
+	if !c.matchAny {
+		c.value = strings.Trim(parts[1], `'"`)
+		if c.value == "" {
+			return nil, errors.New("jsonpath condition has to have a value after the equal sign, like jsonpath='{.status.readyReplicas}'=3")
+		}
+	}
+
+	return c, nil
+}
+
+func (c *jsonPathCondition) Evaluate(obj runtime.Object) (bool, string, error) {
+	content, err := toUnstructuredContent(obj)
+	if err != nil {
+		return false, "", err
+	}
+
+	results, err := c.parser.FindResults(content)
+	if err != nil {
+		return false, "", err
+	}
+	if len(results) == 0 || len(results[0]) == 0 {
+		return false, "<none>", nil
+	}
+	if len(results) > 1 {
+		return false, "", errors.New("given jsonpath expression matches more than one list")
+	}
+	if len(results[0]) > 1 {
+		return false, "", errors.New("given jsonpath expression matches more than one value")
+	}
+
+	switch results[0][0].Interface().(type) {
+	case map[string]interface{}, []interface{}:
+		if c.matchAny {
+			return true, "<object>", nil
+		}
+		return false, "", errors.New("jsonpath leads to a nested object or list which is not supported")
+	}
+
+	current := strings.TrimSpace(fmt.Sprintf("%v", results[0][0].Interface()))
+	if c.matchAny {
+		return true, current, nil
+	}
+	return current == strings.TrimSpace(c.value), current, nil
+}
+
+func (c *jsonPathCondition) Describe(current string) string {
+	if c.matchAny {
+		return fmt.Sprintf("%s is %s, expected it to exist", c.expression, current)
+	}
+	return fmt.Sprintf("%s is %s, expected %s", c.expression, current, c.value)
+}
+
+func (c *jsonPathCondition) String() string {
+	return fmt.Sprintf("jsonpath=%s", c.input)
+}
+
+// splitJSONPathInput splits the input on single '=', a double '==' will not cause the string to be split.
+func splitJSONPathInput(input string) []string {
+	var output []string
+	var element strings.Builder
+	for i := 0; i < len(input); i++ {
+		if input[i] == '=' {
+			if i < len(input)-1 && input[i+1] == '=' {
+				element.WriteString("==")
+				i++
+				continue
+			}
+			output = append(output, element.String())
+			element.Reset()
+			continue
+		}
+		element.WriteByte(input[i])
+	}
+	return append(output, element.String())
+}
@@ -0,0 +1,118 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package conditions
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	tests := []struct {
+		input      string
+		expression string
+		value      string
+		matchAny   bool
+		err        bool
+	}{
+		{input: "jsonpath='{.status.phase}'=Running", expression: "{.status.phase}", value: "Running"},
+		{input: `jsonpath="{.status.phase}"="Running"`, expression: "{.status.phase}", value: "Running"},
+		{input: "JSONPath={.status.readyReplicas}=3", expression: "{.status.readyReplicas}", value: "3"},
+		{input: "jsonpath=.status.readyReplicas=3", expression: "{.status.readyReplicas}", value: "3"},
+		{input: "jsonpath='{.status.loadBalancer.ingress}'", expression: "{.status.loadBalancer.ingress}", matchAny: true},
+		{input: "jsonpath='{.status.conditions[?(@.type==\"Ready\")].status}'=True", expression: "{.status.conditions[?(@.type==\"Ready\")].status}", value: "True"},
+		{input: "jsonpath=", err: true},
+		{input: "jsonpath='{.status.phase}'=", err: true},
+		{input: "jsonpath='{.status.phase}'=Running=Failed", err: true},
+		{input: "jsonpath='{.status.phase'=Running", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			condition, err := Parse(tt.input)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", condition)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			c, ok := condition.(*jsonPathCondition)
+			if !ok {
+				t.Fatalf("expected a jsonpath condition, got %T", condition)
+			}
+			if c.expression != tt.expression || c.value != tt.value || c.matchAny != tt.matchAny {
+				t.Errorf("got expression %q, value %q, matchAny %v", c.expression, c.value, c.matchAny)
+			}
+		})
+	}
+}
+
+func TestEvaluateJSONPath(t *testing.T) {
+	pod := &corev1.Pod{
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+		},
+	}
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec":   map[string]interface{}{"replicas": int64(3)},
+		"status": map[string]interface{}{"readyReplicas": int64(3)},
+	}}
+
+	tests := []struct {
+		input   string
+		obj     runtime.Object
+		met     bool
+		current string
+		err     bool
+	}{
+		{input: "jsonpath='{.status.phase}'=Running", obj: pod, met: true, current: "Running"},
+		{input: "jsonpath='{.status.phase}'=Succeeded", obj: pod, met: false, current: "Running"},
+		{input: "jsonpath='{.status.conditions[?(@.type==\"Ready\")].status}'=True", obj: pod, met: true, current: "True"},
+		{input: "jsonpath='{.status.podIP}'", obj: pod, met: false, current: "<none>"},
+		{input: "jsonpath='{.status.conditions}'", obj: pod, met: true, current: "<object>"},
+		{input: "jsonpath='{.status.conditions}'=True", obj: pod, err: true},
+		{input: "jsonpath='{.status.readyReplicas}'=3", obj: deployment, met: true, current: "3"},
+		{input: "jsonpath='{.spec.replicas}'", obj: deployment, met: true, current: "3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			condition, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			met, current, err := condition.Evaluate(tt.obj)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %v (%s)", met, current)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if met != tt.met || current != tt.current {
+				t.Errorf("got %v (%s), want %v (%s)", met, current, tt.met, tt.current)
+			}
+		})
+	}
+}
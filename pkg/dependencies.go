@@ -0,0 +1,133 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package pkg
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+// LinkDependencies checks that all dependencies of items refer to known ids or groups and that there are no cycles
+// through dependencies and group members. It needs to be called after LinkGroups.
+func (w *Waitables) LinkDependencies() error {
+	for _, item := range w.dependents {
+		for _, name := range item.cluster.getState(item.ref).after {
+			if w.resolveDependency(name) == nil {
+				return fmt.Errorf("unknown id or group '%s' in the dependencies of %s", name, item.getName())
+			}
+		}
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	marks := map[groupMember]int{}
+
+	var visit func(m groupMember) error
+	visit = func(m groupMember) error {
+		switch marks[m] {
+		case visiting:
+			return fmt.Errorf("dependency cycle through %s", m.getName())
+		case visited:
+			return nil
+		}
+		marks[m] = visiting
+		for _, dependency := range w.getDependencies(m) {
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+		marks[m] = visited
+		return nil
+	}
+
+	for _, item := range w.dependents {
+		if err := visit(item); err != nil {
+			return err
+		}
+	}
+	for _, g := range w.getGroups() {
+		if err := visit(g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveDependency returns the item with the id, or otherwise the group with the name.
+func (w *Waitables) resolveDependency(name string) groupMember {
+	if item, ok := w.ids[name]; ok {
+		return item
+	}
+	if g, ok := w.Groups[name]; ok {
+		return g
+	}
+	return nil
+}
+
+// getDependencies returns what needs to be done before the item or group can be done.
+func (w *Waitables) getDependencies(m groupMember) []groupMember {
+	switch v := m.(type) {
+	case *Group:
+		return v.members
+	case *clusterItem:
+		dependencies := []groupMember{}
+		for _, name := range v.cluster.getState(v.ref).after {
+			dependencies = append(dependencies, w.resolveDependency(name))
+		}
+		return dependencies
+	}
+	return nil
+}
+
+// ActivateItems starts waiting for the items of which all dependencies are done.
+// It returns the clusters that have newly activated items, those might need additional informers.
+func (w *Waitables) ActivateItems(now time.Time) []*Cluster {
+	clusters := []*Cluster{}
+
+	// activated items can be done right away, so repeat until nothing changes
+	for changed := true; changed; {
+		changed = false
+		for _, item := range w.dependents {
+			state := item.cluster.getState(item.ref)
+			if state.active || !w.areDependenciesDone(item) {
+				continue
+			}
+			log.Printf("Dependencies of %s are done, starting to wait for it", item.getName())
+			state.active = true
+			state.activatedAt = now
+			changed = true
+			if !slices.Contains(clusters, item.cluster) {
+				clusters = append(clusters, item.cluster)
+			}
+		}
+	}
+
+	return clusters
+}
+
+func (w *Waitables) areDependenciesDone(item *clusterItem) bool {
+	for _, dependency := range w.getDependencies(item) {
+		if !dependency.isDone() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package pkg
+
+import "testing"
+
+func TestLinkDependencies(t *testing.T) {
+	tests := []struct {
+		name   string
+		groups []string
+		args   []string
+		err    string
+	}{
+		{
+			name: "chain of items",
+			args: []string{"pod,db;id=db", "pod,api;id=api;after=db", "pod,web;after=api"},
+		},
+		{
+			name: "item after several items",
+			args: []string{"pod,db;id=db", "pod,cache;id=cache", "pod,api;after=db,cache"},
+		},
+		{
+			name:   "item after a group",
+			groups: []string{"backend=all"},
+			args:   []string{"pod,db;group=backend", "pod,cache;group=backend", "pod,api;after=backend"},
+		},
+		{
+			name: "unknown id",
+			args: []string{"pod,api;after=db"},
+			err:  "unknown id or group 'db' in the dependencies of",
+		},
+		{
+			name: "item after itself",
+			args: []string{"pod,api;id=api;after=api"},
+			err:  "dependency cycle",
+		},
+		{
+			name: "items after each other",
+			args: []string{"pod,db;id=db;after=api", "pod,api;id=api;after=db"},
+			err:  "dependency cycle",
+		},
+		{
+			name:   "item after its own group",
+			groups: []string{"backend=all"},
+			args:   []string{"pod,db;group=backend;after=backend"},
+			err:    "dependency cycle",
+		},
+		{
+			name:   "cycle through a nested group",
+			groups: []string{"all=all", "backend=any;group=all"},
+			args:   []string{"pod,db;group=backend;after=cache", "pod,cache;id=cache;after=all"},
+			err:    "dependency cycle",
+		},
+		{
+			name:   "cycle through a group and an item",
+			groups: []string{"backend=all"},
+			args:   []string{"pod,db;group=backend;after=api", "pod,api;id=api;after=backend"},
+			err:    "dependency cycle",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := linkWaitables(t, tt.groups, tt.args)
+			checkError(t, err, tt.err)
+		})
+	}
+}
@@ -0,0 +1,354 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/erayan/k8s-wait-for-multi/pkg/items"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/kubectl/pkg/util/podutils"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// DiagnosticsIndexFile lists the collected files of every item that is not done.
+	DiagnosticsIndexFile = "index.yaml"
+	// maxDiagnosticsPods limits how many pods are collected for a single item, e.g. for services with many replicas.
+	maxDiagnosticsPods = 10
+)
+
+// unsafePathCharacters are replaced in the directory names of items.
+var unsafePathCharacters = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// DiagnosticsClients read the objects, Events and logs of a kubeconfig context for the diagnostics.
+type DiagnosticsClients struct {
+	Client    client.Client
+	Clientset kubernetes.Interface
+}
+
+type diagnosticsIndex struct {
+	CreatedAt time.Time          `json:"createdAt"`
+	Error     string             `json:"error"`
+	Items     []*diagnosticsItem `json:"items"`
+}
+
+type diagnosticsItem struct {
+	// Item is the item in the form CONTEXT:NAMESPACE/KIND/NAME.
+	Item   string `json:"item"`
+	Status string `json:"status"`
+	// Files are relative to the diagnostics directory.
+	Files []string `json:"files,omitempty"`
+	// Errors describe what could not be collected.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// podDiagnostics is the part of the status of a pod that explains why it is not ready.
+type podDiagnostics struct {
+	Phase                 corev1.PodPhase          `json:"phase"`
+	Reason                string                   `json:"reason,omitempty"`
+	Message               string                   `json:"message,omitempty"`
+	Conditions            []corev1.PodCondition    `json:"conditions,omitempty"`
+	InitContainerStatuses []corev1.ContainerStatus `json:"initContainerStatuses,omitempty"`
+	ContainerStatuses     []corev1.ContainerStatus `json:"containerStatuses,omitempty"`
+}
+
+// WriteDiagnostics writes for every item that is not done its object, the conditions and container statuses of its pods that are not ready,
+// their recent Events and the last logLines lines of the logs of their containers that are not ready, in a directory per item.
+// DiagnosticsIndexFile lists the files of every item, parts that could not be collected are recorded there instead of failing.
+func (w *Waitables) WriteDiagnostics(ctx context.Context, dir string, logLines int64, clients func(context string) (*DiagnosticsClients, error), reason error) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	index := diagnosticsIndex{CreatedAt: time.Now().UTC().Truncate(time.Second), Items: []*diagnosticsItem{}}
+	if reason != nil {
+		index.Error = reason.Error()
+	}
+
+	for _, item := range w.getUnfinished(time.Now()) {
+		entry := &diagnosticsItem{Item: item.name, Status: item.reason}
+		index.Items = append(index.Items, entry)
+
+		c, err := clients(item.cluster.name)
+		if err != nil {
+			entry.Errors = append(entry.Errors, err.Error())
+			continue
+		}
+		d := &diagnosticsWriter{
+			clients:  c,
+			dir:      dir,
+			itemDir:  strings.Trim(unsafePathCharacters.ReplaceAllString(item.name, "_"), "_"),
+			logLines: logLines,
+			entry:    entry,
+		}
+		item.cluster.writeDiagnostics(ctx, d, item.ref)
+	}
+
+	data, err := yaml.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, DiagnosticsIndexFile), data, 0o644)
+}
+
+// writeDiagnostics writes the object of the item and its pods that are not ready, pods of jobs and other workloads are found through their selector.
+func (c *Cluster) writeDiagnostics(ctx context.Context, d *diagnosticsWriter, ref itemRef) {
+	var obj *unstructured.Unstructured
+	pods := []string{}
+
+	switch ref.Kind {
+	case itemKindService:
+		obj = d.writeObject(ctx, ServiceGVK, ref.Namespace, ref.Name)
+		pods = getNotReadyPods(*c.Services[ref.Namespace][ref.Name].GetChildren())
+	case itemKindPod:
+		pods = append(pods, c.Pods[ref.Namespace][ref.Name].GetName())
+	case itemKindJob:
+		obj = d.writeObject(ctx, JobGVK, ref.Namespace, ref.Name)
+	case itemKindOwner:
+		pods = getNotReadyPods(*c.Owners[ref.Namespace][ref.Name].GetChildren())
+	case itemKindSelector:
+		pods = getNotReadyPods(*c.Selectors[ref.Namespace][ref.Name].GetChildren())
+	case itemKindResource:
+		val := c.Resources[ref.Namespace][ref.Name]
+		obj = d.writeObject(ctx, val.GetGroupVersionKind(), ref.Namespace, val.GetObjectName())
+	}
+
+	if obj != nil && (ref.Kind == itemKindJob || ref.Kind == itemKindResource) {
+		pods = d.listPods(ctx, obj)
+	}
+	if len(pods) > maxDiagnosticsPods {
+		d.fail("only %d of %d pods are collected", maxDiagnosticsPods, len(pods))
+		pods = pods[:maxDiagnosticsPods]
+	}
+
+	involved := []string{}
+	if obj != nil {
+		involved = append(involved, obj.GetName())
+	}
+	for _, pod := range pods {
+		if d.writePod(ctx, ref.Namespace, pod) {
+			involved = append(involved, pod)
+		}
+	}
+	d.writeEvents(ctx, ref.Namespace, involved)
+}
+
+// getNotReadyPods returns the names of the pods in the collection that are not ready, sorted by name.
+func getNotReadyPods(pods items.PodCollection) []string {
+	names := []string{}
+	for _, name := range sortedKeys(pods) {
+		if !pods[name].IsReady() {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// diagnosticsWriter writes the files of a single item.
+type diagnosticsWriter struct {
+	clients *DiagnosticsClients
+	dir     string
+	// itemDir is the directory of the item relative to dir.
+	itemDir  string
+	logLines int64
+	entry    *diagnosticsItem
+}
+
+func (d *diagnosticsWriter) fail(format string, args ...any) {
+	d.entry.Errors = append(d.entry.Errors, fmt.Sprintf(format, args...))
+}
+
+// write writes a file to the directory of the item and adds it to the index.
+func (d *diagnosticsWriter) write(name string, data []byte) {
+	path := filepath.Join(d.itemDir, name)
+	if err := os.MkdirAll(filepath.Join(d.dir, d.itemDir), 0o755); err != nil {
+		d.fail("unable to write %s: %s", path, err.Error())
+		return
+	}
+	if err := os.WriteFile(filepath.Join(d.dir, path), data, 0o644); err != nil {
+		d.fail("unable to write %s: %s", path, err.Error())
+		return
+	}
+	d.entry.Files = append(d.entry.Files, filepath.ToSlash(path))
+}
+
+func (d *diagnosticsWriter) writeYAML(name string, obj any) {
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		d.fail("unable to write %s: %s", name, err.Error())
+		return
+	}
+	d.write(name, data)
+}
+
+// writeObject writes the object without its managed fields, it returns nil when the object could not be read.
+func (d *diagnosticsWriter) writeObject(ctx context.Context, gvk schema.GroupVersionKind, namespace string, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	if err := d.clients.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, obj); err != nil {
+		d.fail("unable to get %s/%s: %s", strings.ToLower(gvk.Kind), name, err.Error())
+		return nil
+	}
+	obj.SetManagedFields(nil)
+	d.writeYAML(fmt.Sprintf("%s.yaml", strings.ToLower(gvk.Kind)), obj.Object)
+	return obj
+}
+
+// listPods returns the pods matched by the selector of the workload that are neither ready nor succeeded, sorted by name.
+func (d *diagnosticsWriter) listPods(ctx context.Context, obj *unstructured.Unstructured) []string {
+	selectorMap, found, err := unstructured.NestedMap(obj.Object, "spec", "selector")
+	if err != nil || !found {
+		return nil
+	}
+	labelSelector := &metav1.LabelSelector{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(selectorMap, labelSelector); err != nil {
+		d.fail("unable to read the selector of %s: %s", obj.GetName(), err.Error())
+		return nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		d.fail("unable to read the selector of %s: %s", obj.GetName(), err.Error())
+		return nil
+	}
+
+	pods, err := d.clients.Clientset.CoreV1().Pods(obj.GetNamespace()).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		d.fail("unable to list the pods of %s: %s", obj.GetName(), err.Error())
+		return nil
+	}
+
+	names := []string{}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodSucceeded && !podutils.IsPodReady(&pod) {
+			names = append(names, pod.Name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// writePod writes the pod, its conditions and container statuses and the logs of its containers that are not ready.
+// It returns false when the pod could not be read.
+func (d *diagnosticsWriter) writePod(ctx context.Context, namespace string, name string) bool {
+	pod, err := d.clients.Clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		d.fail("unable to get pod/%s: %s", name, err.Error())
+		return false
+	}
+	pod.ManagedFields = nil
+	pod.APIVersion = "v1"
+	pod.Kind = "Pod"
+	d.writeYAML(fmt.Sprintf("pod-%s.yaml", name), pod)
+
+	d.writeYAML(fmt.Sprintf("pod-%s-status.yaml", name), podDiagnostics{
+		Phase:                 pod.Status.Phase,
+		Reason:                pod.Status.Reason,
+		Message:               pod.Status.Message,
+		Conditions:            pod.Status.Conditions,
+		InitContainerStatuses: pod.Status.InitContainerStatuses,
+		ContainerStatuses:     pod.Status.ContainerStatuses,
+	})
+
+	for _, status := range slices.Concat(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses) {
+		if status.Ready || (status.State.Terminated != nil && status.State.Terminated.ExitCode == 0) {
+			continue
+		}
+		if status.State.Running != nil || status.State.Terminated != nil {
+			d.writeLogs(ctx, pod, status.Name, false)
+		}
+		// the logs of the crashed container explain a crash loop
+		if status.RestartCount > 0 {
+			d.writeLogs(ctx, pod, status.Name, true)
+		}
+	}
+	return true
+}
+
+func (d *diagnosticsWriter) writeLogs(ctx context.Context, pod *corev1.Pod, container string, previous bool) {
+	name := fmt.Sprintf("pod-%s-%s.log", pod.Name, container)
+	if previous {
+		name = fmt.Sprintf("pod-%s-%s-previous.log", pod.Name, container)
+	}
+
+	options := &corev1.PodLogOptions{Container: container, Previous: previous}
+	if d.logLines > 0 {
+		options.TailLines = &d.logLines
+	}
+	logs, err := d.clients.Clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, options).DoRaw(ctx)
+	if err != nil {
+		d.fail("unable to get the logs of %s: %s", strings.TrimSuffix(name, ".log"), err.Error())
+		return
+	}
+	d.write(name, logs)
+}
+
+// writeEvents writes the Events of the objects with the given names to events.txt, sorted by when they were last seen.
+func (d *diagnosticsWriter) writeEvents(ctx context.Context, namespace string, names []string) {
+	events := []corev1.Event{}
+	seen := map[string]bool{}
+	for _, name := range names {
+		selector := fields.OneTermEqualSelector("involvedObject.name", name).String()
+		list, err := d.clients.Clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{FieldSelector: selector})
+		if err != nil {
+			d.fail("unable to list the events of %s: %s", name, err.Error())
+			continue
+		}
+		// the names can repeat, e.g. when the object and one of its pods have the same name
+		for _, event := range list.Items {
+			key := event.Namespace + "/" + event.Name
+			if !seen[key] {
+				seen[key] = true
+				events = append(events, event)
+			}
+		}
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	slices.SortStableFunc(events, func(a, b corev1.Event) int {
+		return getEventTime(&a).Compare(getEventTime(&b))
+	})
+
+	buf := &bytes.Buffer{}
+	table := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "LAST SEEN\tTYPE\tREASON\tOBJECT\tCOUNT\tMESSAGE")
+	for _, event := range events {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s/%s\t%d\t%s\n", getEventTime(&event).UTC().Format(time.RFC3339), event.Type, event.Reason,
+			strings.ToLower(event.InvolvedObject.Kind), event.InvolvedObject.Name, event.Count, strings.TrimSpace(event.Message))
+	}
+	table.Flush()
+	d.write("events.txt", buf.Bytes())
+}
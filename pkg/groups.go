@@ -0,0 +1,167 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package pkg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xlab/treeprint"
+)
+
+const (
+	GroupModeAll    = "all"
+	GroupModeAny    = "any"
+	GroupModeQuorum = "quorum"
+)
+
+// groupMember is an item or another group inside a group.
+type groupMember interface {
+	isDone() bool
+	getName() string
+	addStatusNode(tree treeprint.Tree)
+}
+
+// Group is done when enough of its members are done, members are items and other groups.
+type Group struct {
+	Name string
+	// Parent is the name of the group this group is a member of, the empty string for top level groups.
+	Parent string
+
+	mode     string
+	quorum   int
+	members  []groupMember
+	isMember bool
+}
+
+// clusterItem is a single item of a cluster, as a member of a group or a dependency of another item.
+type clusterItem struct {
+	cluster *Cluster
+	ref     itemRef
+}
+
+// ParseGroup parses a group in the form NAME=MODE, optionally followed by ;group=PARENT to nest it in another group.
+// MODE is one of all, any or quorum:N.
+func ParseGroup(arg string) (*Group, error) {
+	options := splitTopLevel(arg, ';')
+
+	name, mode, found := strings.Cut(options[0], "=")
+	if !found || name == "" || mode == "" {
+		return nil, fmt.Errorf("expected the group in the form NAME=MODE, got '%s'", options[0])
+	}
+
+	g := &Group{Name: name}
+
+	switch {
+	case mode == GroupModeAll || mode == GroupModeAny:
+		g.mode = mode
+	case strings.HasPrefix(mode, GroupModeQuorum+":"):
+		quorum, err := strconv.Atoi(strings.TrimPrefix(mode, GroupModeQuorum+":"))
+		if err != nil || quorum < 1 {
+			return nil, fmt.Errorf("quorum of group '%s' must be a positive number", name)
+		}
+		g.mode = GroupModeQuorum
+		g.quorum = quorum
+	default:
+		return nil, fmt.Errorf("unknown mode '%s' for group '%s', expected all, any or quorum:N", mode, name)
+	}
+
+	for _, option := range options[1:] {
+		key, value, _ := strings.Cut(option, "=")
+		switch key {
+		case "group":
+			if value == "" {
+				return nil, fmt.Errorf("group option needs a group name")
+			}
+			if value == name {
+				return nil, fmt.Errorf("group '%s' can not be a member of itself", name)
+			}
+			g.Parent = value
+		default:
+			return nil, fmt.Errorf("unknown option '%s'", key)
+		}
+	}
+
+	return g, nil
+}
+
+func (g *Group) addMember(m groupMember) {
+	g.members = append(g.members, m)
+}
+
+// getRequired returns how many members need to be done for the group to be done.
+func (g *Group) getRequired() int {
+	switch g.mode {
+	case GroupModeAny:
+		return 1
+	case GroupModeQuorum:
+		return g.quorum
+	}
+	return len(g.members)
+}
+
+func (g *Group) getDoneCount() int {
+	count := 0
+	for _, m := range g.members {
+		if m.isDone() {
+			count++
+		}
+	}
+	return count
+}
+
+func (g *Group) getMode() string {
+	if g.mode == GroupModeQuorum {
+		return fmt.Sprintf("%s:%d", g.mode, g.quorum)
+	}
+	return g.mode
+}
+
+func (g *Group) isDone() bool {
+	return g.getDoneCount() >= g.getRequired()
+}
+
+func (g *Group) getName() string {
+	return fmt.Sprintf("group/%s", g.Name)
+}
+
+// addStatusNode adds the group as a branch with its progress, members that are not done are ignored once the group is done.
+func (g *Group) addStatusNode(tree treeprint.Tree) {
+	done := g.isDone()
+	branch := tree.AddMetaBranch(doneStatus(done), fmt.Sprintf("%s: %d/%d (%s)", g.getName(), g.getDoneCount(), len(g.members), g.getMode()))
+
+	for _, m := range g.members {
+		m.addStatusNode(branch)
+		if done && !m.isDone() {
+			nodes := branch.(*treeprint.Node).Nodes
+			nodes[len(nodes)-1].Meta = TreeStatusIgnored
+		}
+	}
+}
+
+func (i *clusterItem) isDone() bool {
+	return i.cluster.isItemDone(i.ref)
+}
+
+func (i *clusterItem) getName() string {
+	return i.cluster.getQualifiedItemName(i.ref)
+}
+
+func (i *clusterItem) addStatusNode(tree treeprint.Tree) {
+	i.cluster.addItemNode(tree, i.ref, i.getName())
+}
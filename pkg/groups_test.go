@@ -0,0 +1,121 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package pkg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/erayan/k8s-wait-for-multi/flags"
+)
+
+// linkWaitables adds the groups and targets to new waitables the way the wait command does, and links them.
+func linkWaitables(t *testing.T, groups []string, args []string) (*Waitables, error) {
+	t.Helper()
+	w := NewWaitables(flags.NewConfigFlags())
+	for _, arg := range groups {
+		g, err := ParseGroup(arg)
+		if err != nil {
+			t.Fatalf("ParseGroup(%q) failed: %v", arg, err)
+		}
+		if err := w.AddGroup(g); err != nil {
+			return w, err
+		}
+	}
+	for _, arg := range args {
+		target, err := ParseTarget(arg, Target{Namespace: "default"}, nil)
+		if err != nil {
+			t.Fatalf("ParseTarget(%q) failed: %v", arg, err)
+		}
+		if err := w.AddTarget(target); err != nil {
+			return w, err
+		}
+	}
+	if err := w.LinkGroups(); err != nil {
+		return w, err
+	}
+	return w, w.LinkDependencies()
+}
+
+// checkError fails the test when the error does not contain want, or when there is an error while want is empty.
+func checkError(t *testing.T, err error, want string) {
+	t.Helper()
+	switch {
+	case want == "" && err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case want != "" && err == nil:
+		t.Fatalf("expected an error containing %q", want)
+	case want != "" && !strings.Contains(err.Error(), want):
+		t.Fatalf("expected an error containing %q, got %v", want, err)
+	}
+}
+
+func TestLinkGroups(t *testing.T) {
+	tests := []struct {
+		name   string
+		groups []string
+		args   []string
+		err    string
+	}{
+		{
+			name:   "items in a group",
+			groups: []string{"web=any"},
+			args:   []string{"pod,web-1;group=web", "pod,web-2;group=web"},
+		},
+		{
+			name:   "nested groups",
+			groups: []string{"all=all", "web=quorum:2;group=all", "db=any;group=all"},
+			args:   []string{"pod,web-1;group=web", "pod,web-2;group=web", "pod,web-3;group=web", "pod,db;group=db"},
+		},
+		{
+			name:   "groups that are members of each other",
+			groups: []string{"a=all;group=b", "b=all;group=a"},
+			args:   []string{"pod,web;group=a"},
+			err:    "is (indirectly) a member of itself",
+		},
+		{
+			name:   "cycle through three groups",
+			groups: []string{"a=all;group=b", "b=all;group=c", "c=any;group=a"},
+			args:   []string{"pod,web;group=a"},
+			err:    "is (indirectly) a member of itself",
+		},
+		{
+			name:   "unknown parent",
+			groups: []string{"a=all;group=missing"},
+			args:   []string{"pod,web;group=a"},
+			err:    "unknown group 'missing'",
+		},
+		{
+			name:   "group without members",
+			groups: []string{"a=all", "b=any"},
+			args:   []string{"pod,web;group=a"},
+			err:    "group 'b' has no members",
+		},
+		{
+			name:   "quorum larger than the group",
+			groups: []string{"a=quorum:3"},
+			args:   []string{"pod,web-1;group=a", "pod,web-2;group=a"},
+			err:    "requires 3 members but only has 2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := linkWaitables(t, tt.groups, tt.args)
+			checkError(t, err, tt.err)
+		})
+	}
+}
@@ -18,174 +18,440 @@ package pkg
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/erayan/k8s-wait-for-multi/pkg/items"
+	"github.com/erayan/k8s-wait-for-multi/utils"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 )
 
-func (w *Waitables) ProcessEventAddService(ctx context.Context, svc *corev1.Service) (bool, error) {
-	if w.HasService(svc.ObjectMeta) {
+const (
+	// maxOwnerDepth limits how far up the ownership chain of a pod is followed.
+	maxOwnerDepth = 8
+	// lookupTimeout limits how long a lookup of the handlers may take.
+	lookupTimeout = 5 * time.Second
+)
+
+func (c *Cluster) ProcessEventAddService(ctx context.Context, svc *corev1.Service) (bool, error) {
+	if c.HasService(svc.ObjectMeta) {
 		//log.Printf("Add %T %s %s", svc, svc.Namespace, svc.Name)
-		pods, err := w.getPodsForSvc(ctx, svc)
+		pods, err := c.getPodsForSvc(ctx, svc)
 
 		if err != nil {
 			return true, err
 		}
 
-		w.SetServiceChildren(&svc.ObjectMeta, pods.Items)
-		w.SetServiceExternality(&svc.ObjectMeta, svc.Spec.Type == corev1.ServiceTypeExternalName)
-		return true, nil
+		c.SetServiceChildren(&svc.ObjectMeta, pods.Items)
+		c.SetServiceExternality(&svc.ObjectMeta, svc.Spec.Type == corev1.ServiceTypeExternalName)
+		c.SetServiceConditionFromService(&svc.ObjectMeta, svc)
+		return true, c.SetServiceWorkloads(ctx, &svc.ObjectMeta, svc.Spec.Selector)
 	}
 	return false, nil
 }
 
-func (w *Waitables) ProcessEventUpdateService(ctx context.Context, svc *corev1.Service) (bool, error) {
-	if w.HasService(svc.ObjectMeta) {
+func (c *Cluster) ProcessEventUpdateService(ctx context.Context, svc *corev1.Service) (bool, error) {
+	if c.HasService(svc.ObjectMeta) {
 		//log.Printf("Update %T %s %s", svc, svc.Namespace, svc.Name)
-		pods, err := w.getPodsForSvc(ctx, svc)
+		pods, err := c.getPodsForSvc(ctx, svc)
 
 		if err != nil {
 			return true, err
 		}
 
-		w.SetServiceChildren(&svc.ObjectMeta, pods.Items)
-		w.SetServiceExternality(&svc.ObjectMeta, svc.Spec.Type == corev1.ServiceTypeExternalName)
-		return true, nil
+		c.SetServiceChildren(&svc.ObjectMeta, pods.Items)
+		c.SetServiceExternality(&svc.ObjectMeta, svc.Spec.Type == corev1.ServiceTypeExternalName)
+		c.SetServiceConditionFromService(&svc.ObjectMeta, svc)
+		return true, c.SetServiceWorkloads(ctx, &svc.ObjectMeta, svc.Spec.Selector)
 	}
 	return false, nil
 }
 
-func (w *Waitables) ProcessEventDeleteService(ctx context.Context, svc *corev1.Service) (bool, error) {
-	if w.HasService(svc.ObjectMeta) {
+func (c *Cluster) ProcessEventDeleteService(ctx context.Context, svc *corev1.Service) (bool, error) {
+	if c.HasService(svc.ObjectMeta) {
 		//log.Printf("Delete %T %s %s", svc, svc.Namespace, svc.Name)
 
-		w.SetServiceChildren(&svc.ObjectMeta, nil)
-		w.SetServiceExternality(&svc.ObjectMeta, svc.Spec.Type == corev1.ServiceTypeExternalName)
-		return true, nil
+		c.SetServiceChildren(&svc.ObjectMeta, nil)
+		c.SetServiceExternality(&svc.ObjectMeta, svc.Spec.Type == corev1.ServiceTypeExternalName)
+		c.SetServiceConditionFromService(&svc.ObjectMeta, nil)
+		return true, c.SetServiceWorkloads(ctx, &svc.ObjectMeta, nil)
 	}
 	return false, nil
 }
 
-func (w *Waitables) ProcessOldPodEvents(ctx context.Context, pod *corev1.Pod) (bool, error) {
-	if val, ok := w.LastPodEvents[pod.UID]; ok {
+func (c *Cluster) ProcessOldPodEvents(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	if val, ok := c.LastPodEvents[pod.UID]; ok {
 		//log.Printf("Running LastPodEvents for %s/%s of type %v", pod.Namespace, pod.Name, val.EventType)
-		//defer delete(w.LastPodEvents, pod.UID)
+		//defer delete(c.LastPodEvents, pod.UID)
 		switch val.EventType {
 		case EventTypeAdd:
-			return w.ProcessEventAddPod(ctx, pod)
+			return c.ProcessEventAddPod(ctx, pod)
 		case EventTypeUpdate:
-			return w.ProcessEventUpdatePod(ctx, pod)
+			return c.ProcessEventUpdatePod(ctx, pod)
 		case EventTypeDelete:
-			return w.ProcessEventDeletePod(ctx, pod)
+			return c.ProcessEventDeletePod(ctx, pod)
 		}
 	}
 	return false, nil
 }
 
-func (w *Waitables) ProcessEventAddPod(ctx context.Context, pod *corev1.Pod) (bool, error) {
-	// if w.HasPod(pod.ObjectMeta) {
+func (c *Cluster) ProcessEventAddPod(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	// if c.HasPod(pod.ObjectMeta) {
 	// 	log.Printf("Add %T %s %s", pod, pod.Namespace, pod.Name)
 	// }
 
-	if w.HasPodDirect(pod.ObjectMeta) {
-		w.SetPodReadyFromPod(pod)
+	if c.HasPodDirect(pod.ObjectMeta) {
+		c.SetPodReadyFromPod(pod)
 	}
 
-	if podItems, ok := w.Services.GetPods(pod); ok {
+	if podItems, ok := c.Services.GetPods(pod); ok {
 		for _, podItem := range podItems {
 			podItem.WithReadyFromPod(pod)
 		}
 	}
 
-	w.LastPodEvents[pod.UID] = Event{EventType: EventTypeAdd, Pod: pod}
+	owners, err := c.getOwnersForPod(ctx, pod)
+	if err != nil {
+		return true, err
+	}
+
+	owned := c.SetPodOwners(pod, owners)
+	selected := c.SetPodSelectors(pod)
+
+	c.LastPodEvents[pod.UID] = Event{EventType: EventTypeAdd, Pod: pod}
 
-	return w.HasPod(pod.ObjectMeta), nil
+	return c.HasPod(pod.ObjectMeta) || owned || selected, nil
 }
 
-func (w *Waitables) ProcessEventUpdatePod(ctx context.Context, pod *corev1.Pod) (bool, error) {
-	// if w.HasPod(pod.ObjectMeta) {
+func (c *Cluster) ProcessEventUpdatePod(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	// if c.HasPod(pod.ObjectMeta) {
 	// 	log.Printf("Update %T %s %s", pod, pod.Namespace, pod.Name)
 	// }
 
-	if w.HasPodDirect(pod.ObjectMeta) {
-		w.SetPodReadyFromPod(pod)
+	if c.HasPodDirect(pod.ObjectMeta) {
+		c.SetPodReadyFromPod(pod)
 	}
 
-	if podItems, ok := w.Services.GetPods(pod); ok {
+	if podItems, ok := c.Services.GetPods(pod); ok {
 		for _, podItem := range podItems {
 			podItem.WithReadyFromPod(pod)
 		}
 	}
 
-	w.LastPodEvents[pod.UID] = Event{EventType: EventTypeUpdate, Pod: pod}
+	owners, err := c.getOwnersForPod(ctx, pod)
+	if err != nil {
+		return true, err
+	}
+
+	owned := c.SetPodOwners(pod, owners)
+	selected := c.SetPodSelectors(pod)
 
-	return w.HasPod(pod.ObjectMeta), nil
+	c.LastPodEvents[pod.UID] = Event{EventType: EventTypeUpdate, Pod: pod}
+
+	return c.HasPod(pod.ObjectMeta) || owned || selected, nil
 }
 
-func (w *Waitables) ProcessEventDeletePod(ctx context.Context, pod *corev1.Pod) (bool, error) {
-	// if w.HasPod(pod.ObjectMeta) {
+func (c *Cluster) ProcessEventDeletePod(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	// if c.HasPod(pod.ObjectMeta) {
 	// 	log.Printf("Delete %T %s %s", pod, pod.Namespace, pod.Name)
 	// }
 
-	if w.HasPodDirect(pod.ObjectMeta) {
-		w.UnsetPodReady(pod)
+	if c.HasPodDirect(pod.ObjectMeta) {
+		c.UnsetPodReady(pod)
 	}
 
-	if podItems, ok := w.Services.GetPods(pod); ok {
+	delete(c.podWarnings, pod.UID)
+
+	if podItems, ok := c.Services.GetPods(pod); ok {
 		for _, podItem := range podItems {
 			podItem.WithReady(false)
 		}
-		w.Services.DeletePod(&pod.ObjectMeta)
+		c.Services.DeletePod(&pod.ObjectMeta)
+	}
+
+	owned := c.Owners.ContainsPod(&pod.ObjectMeta)
+	if owned {
+		c.Owners.DeletePod(&pod.ObjectMeta)
+	}
+
+	selected := c.Selectors.ContainsPod(&pod.ObjectMeta)
+	if selected {
+		c.Selectors.DeletePod(&pod.ObjectMeta)
 	}
 
-	w.LastPodEvents[pod.UID] = Event{EventType: EventTypeDelete, Pod: pod}
+	c.LastPodEvents[pod.UID] = Event{EventType: EventTypeDelete, Pod: pod}
 
-	return w.HasPod(pod.ObjectMeta), nil
+	return c.HasPod(pod.ObjectMeta) || owned || selected, nil
 }
 
-func (w *Waitables) ProcessEventAddJob(ctx context.Context, job *batchv1.Job) (bool, error) {
-	if w.HasJob(job.ObjectMeta) {
+func (c *Cluster) ProcessEventAddJob(ctx context.Context, job *batchv1.Job) (bool, error) {
+	if c.HasJob(job.ObjectMeta) {
 		//log.Printf("Add %T %s %s", job, job.Namespace, job.Name)
-		w.SetJobCompleteFromJob(job)
+		c.SetJobCompleteFromJob(job)
 		return true, nil
 	}
 	return false, nil
 }
 
-func (w *Waitables) ProcessEventUpdateJob(ctx context.Context, job *batchv1.Job) (bool, error) {
-	if w.HasJob(job.ObjectMeta) {
+func (c *Cluster) ProcessEventUpdateJob(ctx context.Context, job *batchv1.Job) (bool, error) {
+	if c.HasJob(job.ObjectMeta) {
 		//log.Printf("Update %T %s %s", job, job.Namespace, job.Name)
-		w.SetJobCompleteFromJob(job)
+		c.SetJobCompleteFromJob(job)
 		return true, nil
 	}
 	return false, nil
 }
 
-func (w *Waitables) ProcessEventDeleteJob(ctx context.Context, job *batchv1.Job) (bool, error) {
-	if w.HasJob(job.ObjectMeta) {
+func (c *Cluster) ProcessEventDeleteJob(ctx context.Context, job *batchv1.Job) (bool, error) {
+	if c.HasJob(job.ObjectMeta) {
 		//log.Printf("Delete %T %s %s", job, job.Namespace, job.Name)
-		w.UnsetJobComplete(job)
+		c.UnsetJobComplete(job)
 		return true, nil
 	}
 	return false, nil
 }
 
-func (w *Waitables) getPodsForSvc(context context.Context, svc *corev1.Service) (*corev1.PodList, error) {
+// Deployments are also watched for the services whose pods they manage, see SetDeploymentWorkloads.
+func (c *Cluster) ProcessEventAddResource(ctx context.Context, obj *unstructured.Unstructured) (bool, error) {
+	workloads := obj.GroupVersionKind() == DeploymentGVK && c.SetDeploymentWorkloads(obj, false)
+	if c.HasResource(obj) {
+		c.SetResourceReadyFromObject(obj)
+		return true, nil
+	}
+	return workloads, nil
+}
+
+func (c *Cluster) ProcessEventUpdateResource(ctx context.Context, obj *unstructured.Unstructured) (bool, error) {
+	workloads := obj.GroupVersionKind() == DeploymentGVK && c.SetDeploymentWorkloads(obj, false)
+	if c.HasResource(obj) {
+		c.SetResourceReadyFromObject(obj)
+		return true, nil
+	}
+	return workloads, nil
+}
+
+func (c *Cluster) ProcessEventDeleteResource(ctx context.Context, obj *unstructured.Unstructured) (bool, error) {
+	workloads := obj.GroupVersionKind() == DeploymentGVK && c.SetDeploymentWorkloads(obj, true)
+	if c.HasResource(obj) {
+		c.UnsetResourceReady(obj)
+		return true, nil
+	}
+	return workloads, nil
+}
+
+func (c *Cluster) getPodsForSvc(ctx context.Context, svc *corev1.Service) (*corev1.PodList, error) {
+	if err := c.requireSynced(ctx, PodGVK, &corev1.Pod{}); err != nil {
+		return nil, err
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
 	set := labels.Set(svc.Spec.Selector)
 	listOptions := &client.ListOptions{Namespace: svc.Namespace, LabelSelector: set.AsSelector()}
 	pods := &corev1.PodList{}
-	err := w.List(context, pods, listOptions)
+	err := c.List(lookupCtx, pods, listOptions)
 	if err != nil {
 		return nil, err
 	}
 	return pods, err
 }
 
-func (w *Waitables) printRolloutStatus(pod *corev1.Pod) error {
+// NotSyncedError is returned when the informer of a kind that is looked up did not sync yet, reading from its cache would block.
+// The event needs to be processed again once the informer synced.
+type NotSyncedError struct {
+	GroupVersionKind schema.GroupVersionKind
+}
+
+func (e *NotSyncedError) Error() string {
+	return fmt.Sprintf("the cache of %s did not sync yet", strings.ToLower(e.GroupVersionKind.Kind))
+}
+
+// requireSynced returns a NotSyncedError while the informer of the kind did not sync, so that reading from the cache does not block.
+// An informer that can not list or watch its kind returns its persistent error instead, see SetWatchError.
+func (c *Cluster) requireSynced(ctx context.Context, gvk schema.GroupVersionKind, obj client.Object) error {
+	informer, err := c.GetInformer(ctx, obj, cache.BlockUntilSynced(false))
+	if err != nil {
+		return err
+	}
+	if informer.HasSynced() {
+		delete(c.watchErrors, gvk)
+		return nil
+	}
+	if err, ok := c.watchErrors[gvk]; ok {
+		return err
+	}
+	return &NotSyncedError{GroupVersionKind: gvk}
+}
+
+// SetServiceWorkloads records the failures of the Deployments that manage the pods of the service, those are found through
+// the labels of their pod template that match the selector of the service, so they are also found when no pods could be created
+// (e.g. because a quota is exceeded). A nil selector clears them, changes of the Deployments are handled by SetDeploymentWorkloads.
+// When the Deployments are forbidden to look up their failures are not detected, other errors are returned.
+func (c *Cluster) SetServiceWorkloads(ctx context.Context, meta *metav1.ObjectMeta, selector map[string]string) error {
+	svc := c.Services[meta.Namespace][meta.Name]
+	svc.WithPodSelector(selector)
+	svc.WithoutWorkloadFailures()
+	if len(selector) == 0 || c.failedWorkloadLookup {
+		return nil
+	}
+
+	deployment := &unstructured.Unstructured{}
+	deployment.SetGroupVersionKind(DeploymentGVK)
+
+	deployments := &unstructured.UnstructuredList{}
+	deployments.SetGroupVersionKind(DeploymentGVK.GroupVersion().WithKind(DeploymentGVK.Kind + "List"))
+
+	err := c.requireSynced(ctx, DeploymentGVK, deployment)
+	if err == nil {
+		lookupCtx, cancel := context.WithTimeout(ctx, lookupTimeout)
+		defer cancel()
+		err = c.List(lookupCtx, deployments, client.InNamespace(meta.Namespace))
+	}
+	if apierrors.IsForbidden(err) {
+		log.Printf("Unable to look up the deployments of services, their rollout failures will not be detected: %s", err.Error())
+		c.failedWorkloadLookup = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, deployment := range deployments.Items {
+		if matchesPodTemplate(selector, &deployment) {
+			svc.WithWorkloadFailure("deployment/"+deployment.GetName(), utils.GetUnstructuredWorkloadFailure(&deployment))
+		}
+	}
+	return nil
+}
+
+// SetDeploymentWorkloads records the failure of the Deployment on the services whose selector matches its pod template,
+// and clears it on the others. It returns whether any service changed.
+func (c *Cluster) SetDeploymentWorkloads(deployment *unstructured.Unstructured, deleted bool) bool {
+	if c.failedWorkloadLookup {
+		return false
+	}
+
+	workload := "deployment/" + deployment.GetName()
+	failure := ""
+	if !deleted {
+		failure = utils.GetUnstructuredWorkloadFailure(deployment)
+	}
+
+	changed := false
+	for _, svc := range c.Services[deployment.GetNamespace()] {
+		previous := svc.GetWorkloadFailure()
+		if !deleted && matchesPodTemplate(svc.GetPodSelector(), deployment) {
+			svc.WithWorkloadFailure(workload, failure)
+		} else {
+			svc.WithWorkloadFailure(workload, "")
+		}
+		changed = changed || svc.GetWorkloadFailure() != previous
+	}
+	return changed
+}
+
+// matchesPodTemplate returns true when the selector of a service matches the labels of the pod template of the workload.
+func matchesPodTemplate(selector map[string]string, workload *unstructured.Unstructured) bool {
+	if len(selector) == 0 {
+		return false
+	}
+	template, _, _ := unstructured.NestedStringMap(workload.Object, "spec", "template", "metadata", "labels")
+	return labels.SelectorFromSet(selector).Matches(labels.Set(template))
+}
+
+// getOwnersForPod follows the owner references of the pod up the ownership chain and returns all owner items
+// in the namespace of the pod that it is (transitively) owned by.
+func (c *Cluster) getOwnersForPod(ctx context.Context, pod *corev1.Pod) ([]*items.OwnerItem, error) {
+	owners := c.Owners[pod.Namespace]
+	if len(owners) == 0 {
+		return nil, nil
+	}
+
+	matched := []*items.OwnerItem{}
+	visited := map[types.UID]bool{}
+	refs := pod.OwnerReferences
+
+	for depth := 0; len(refs) > 0 && depth < maxOwnerDepth; depth++ {
+		next := []metav1.OwnerReference{}
+		for _, ref := range refs {
+			if visited[ref.UID] {
+				continue
+			}
+			visited[ref.UID] = true
+
+			for _, owner := range owners {
+				if owner.Matches(ref) && !slices.Contains(matched, owner) {
+					matched = append(matched, owner)
+				}
+			}
+			if len(matched) == len(owners) {
+				return matched, nil
+			}
+			ownerRefs, err := c.getOwnerReferences(ctx, pod.Namespace, ref)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, ownerRefs...)
+		}
+		refs = next
+	}
+
+	return matched, nil
+}
+
+// getOwnerReferences returns the owner references of the object the reference points to.
+// Kinds that can not be looked up (e.g. due to missing RBAC permissions) are remembered and skipped afterwards,
+// other errors are returned so that the pod is processed again.
+func (c *Cluster) getOwnerReferences(ctx context.Context, namespace string, ref metav1.OwnerReference) ([]metav1.OwnerReference, error) {
+	gvk := schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind)
+	if _, failed := c.failedOwnerKinds[gvk]; failed {
+		return nil, nil
+	}
+
+	obj := &metav1.PartialObjectMetadata{}
+	obj.SetGroupVersionKind(gvk)
+
+	err := c.requireSynced(ctx, gvk, obj)
+	if err == nil {
+		lookupCtx, cancel := context.WithTimeout(ctx, lookupTimeout)
+		defer cancel()
+		err = c.Get(lookupCtx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, obj)
+	}
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if apierrors.IsForbidden(err) || meta.IsNoMatchError(err) {
+		log.Printf("Unable to look up owners of kind %s, pods owned through it will not be discovered: %s", gvk.Kind, err.Error())
+		c.failedOwnerKinds[gvk] = err
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if obj.UID != ref.UID {
+		return nil, nil
+	}
+
+	return obj.OwnerReferences, nil
+}
+
+func (c *Cluster) printRolloutStatus(pod *corev1.Pod) error {
 	log.Printf("Pod %s is %v", pod.Name, pod.Status.Phase)
 	return nil
 }
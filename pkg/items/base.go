@@ -16,7 +16,117 @@
 
 package items
 
+import (
+	"fmt"
+	"time"
+
+	"github.com/erayan/k8s-wait-for-multi/pkg/conditions"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
 type ItemInterface interface {
 	GetNamespace() string
 	GetName() string
 }
+
+// itemStatus holds what every item tracks besides the readiness of its kind: whether the object exists,
+// and the result of the custom condition, which replaces the default readiness check when set.
+type itemStatus struct {
+	// observed is false until the object was seen, or its absence was confirmed after the initial sync.
+	observed bool
+	exists   bool
+	// missingSince is when the object was first known to not exist, it is zero while the object exists or is not observed yet.
+	missingSince time.Time
+	condition    conditions.Condition
+	met          bool
+	current      string
+	// failure is set when the condition can not be met anymore.
+	failure string
+}
+
+// observe records that the object exists and evaluates the custom condition against it.
+// Evaluation errors are kept as the current value.
+func (s *itemStatus) observe(obj runtime.Object) bool {
+	s.observed = true
+	s.exists = true
+	s.missingSince = time.Time{}
+	s.failure = ""
+	if s.condition == nil {
+		return false
+	}
+
+	if failable, ok := s.condition.(conditions.Failable); ok {
+		s.failure = failable.Failure(obj)
+	}
+
+	met, current, err := s.condition.Evaluate(obj)
+	if err != nil {
+		current = fmt.Sprintf("<error: %s>", err.Error())
+	}
+	s.met = met && err == nil
+	s.current = current
+	return s.met
+}
+
+// absent records that the object does not exist, that only meets the condition when waiting for deletion.
+func (s *itemStatus) absent() bool {
+	if s.missingSince.IsZero() {
+		s.missingSince = time.Now()
+	}
+	s.observed = true
+	s.exists = false
+	s.failure = ""
+	s.met = conditions.IsDelete(s.condition)
+	s.current = ""
+	return s.met
+}
+
+func (s *itemStatus) IsObserved() bool {
+	return s.observed
+}
+
+// IsMissing returns true when the object is known to not exist while it is not waited for to be deleted.
+func (s *itemStatus) IsMissing() bool {
+	return s.observed && !s.exists && !s.WaitsForDeletion()
+}
+
+// GetMissingSince returns since when the object is known to not exist, or the zero time when it exists or was not observed yet.
+func (s *itemStatus) GetMissingSince() time.Time {
+	return s.missingSince
+}
+
+func (s *itemStatus) HasCondition() bool {
+	return s.condition != nil
+}
+
+// GetFailure returns why the item can not be done anymore, or the empty string.
+func (s *itemStatus) GetFailure() string {
+	return s.failure
+}
+
+// ReplacesStatus returns true when the condition describes the whole state of the item, like delete and complete.
+func (s *itemStatus) ReplacesStatus() bool {
+	return conditions.ReplacesStatus(s.condition)
+}
+
+func (s *itemStatus) WaitsForDeletion() bool {
+	return conditions.IsDelete(s.condition)
+}
+
+// GetConditionStatus describes the condition and the last seen value.
+func (s *itemStatus) GetConditionStatus() string {
+	if s.condition == nil {
+		return ""
+	}
+	if s.WaitsForDeletion() && !s.observed {
+		return "Unknown"
+	}
+	if s.WaitsForDeletion() && !s.exists {
+		return "Deleted"
+	}
+	if s.current == "" {
+		return s.condition.Describe("<none>")
+	}
+	return s.condition.Describe(s.current)
+}
@@ -0,0 +1,141 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package items
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ContainerCondition is what a single container of a pod is waited for.
+type ContainerCondition string
+
+const (
+	// ContainerReady waits for the readiness probe of the container, this is the default.
+	ContainerReady ContainerCondition = "ready"
+	// ContainerStarted waits for the startup probe of the container, or for it to run when it has none.
+	ContainerStarted ContainerCondition = "started"
+	// ContainerSucceeded waits for the container to terminate with exit code 0.
+	ContainerSucceeded ContainerCondition = "succeeded"
+)
+
+// ContainerConditions holds all container conditions, they are given as a suffix of the container, e.g. mypod/istio-proxy:started.
+var ContainerConditions = []ContainerCondition{ContainerReady, ContainerStarted, ContainerSucceeded}
+
+// ContainerState is the state of a single container of a pod as shown in the tree.
+type ContainerState struct {
+	Name string
+	// Status describes the state, e.g. Running, Ready or Waiting (CrashLoopBackOff).
+	Status string
+}
+
+// PodKey returns the key used for a pod in a PodCollection, pods that are waited for by container have one key per container.
+func PodKey(name string, container string) string {
+	if container == "" {
+		return name
+	}
+	return fmt.Sprintf("%s/%s", name, container)
+}
+
+// evaluateContainer returns whether the container meets the condition, and why it never will when that is the case.
+func evaluateContainer(pod *corev1.Pod, container string, condition ContainerCondition) (bool, string) {
+	status, found := getContainerStatus(pod, container)
+	if !found {
+		if !hasContainer(pod, container) {
+			return false, fmt.Sprintf("container %s does not exist", container)
+		}
+		return false, ""
+	}
+
+	switch condition {
+	case ContainerStarted:
+		// started stays false until the startup probe succeeded, the state is only used when it is not reported
+		if status.Started != nil {
+			return *status.Started, ""
+		}
+		return status.State.Running != nil || status.State.Terminated != nil, ""
+	case ContainerSucceeded:
+		terminated := status.State.Terminated
+		if terminated == nil {
+			return false, ""
+		}
+		if terminated.ExitCode == 0 {
+			return true, ""
+		}
+		// the kubelet restarts failed containers unless the pod is done or never restarts them
+		if pod.Spec.RestartPolicy == corev1.RestartPolicyNever || pod.Status.Phase == corev1.PodFailed {
+			return false, fmt.Sprintf("%s exited with %d: %s", container, terminated.ExitCode, terminated.Reason)
+		}
+		return false, ""
+	}
+	return status.Ready, ""
+}
+
+// getContainerStates returns the states of all init and regular containers of the pod, in the order of the pod spec.
+func getContainerStates(pod *corev1.Pod) []ContainerState {
+	states := []ContainerState{}
+	for _, container := range append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		status, found := getContainerStatus(pod, container.Name)
+		if !found {
+			states = append(states, ContainerState{Name: container.Name, Status: "Unknown"})
+			continue
+		}
+		states = append(states, ContainerState{Name: container.Name, Status: describeContainerStatus(status)})
+	}
+	return states
+}
+
+// describeContainerStatus returns e.g. Running, Ready, Waiting (CrashLoopBackOff) or Terminated (exited with 1: Error).
+func describeContainerStatus(status corev1.ContainerStatus) string {
+	switch {
+	case status.State.Running != nil && status.Ready:
+		return "Ready"
+	case status.State.Running != nil && status.Started != nil && !*status.Started:
+		return "Running (not started)"
+	case status.State.Running != nil:
+		return "Running"
+	case status.State.Terminated != nil:
+		return fmt.Sprintf("Terminated (exited with %d: %s)", status.State.Terminated.ExitCode, status.State.Terminated.Reason)
+	case status.State.Waiting != nil && status.State.Waiting.Reason != "":
+		return fmt.Sprintf("Waiting (%s)", status.State.Waiting.Reason)
+	}
+	return "Waiting"
+}
+
+// getContainerStatuses returns the statuses of all init and regular containers of the pod.
+func getContainerStatuses(pod *corev1.Pod) []corev1.ContainerStatus {
+	return append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+}
+
+func getContainerStatus(pod *corev1.Pod, name string) (corev1.ContainerStatus, bool) {
+	for _, status := range getContainerStatuses(pod) {
+		if status.Name == name {
+			return status, true
+		}
+	}
+	return corev1.ContainerStatus{}, false
+}
+
+func hasContainer(pod *corev1.Pod, name string) bool {
+	for _, container := range append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		if container.Name == name {
+			return true
+		}
+	}
+	return false
+}
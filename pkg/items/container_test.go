@@ -0,0 +1,56 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package items
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestEvaluateContainerStarted(t *testing.T) {
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	terminated := corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{}}
+	waiting := corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{}}
+
+	tests := []struct {
+		name    string
+		started *bool
+		state   corev1.ContainerState
+		want    bool
+	}{
+		{name: "running before startup probe succeeded", started: ptr.To(false), state: running, want: false},
+		{name: "running after startup probe succeeded", started: ptr.To(true), state: running, want: true},
+		{name: "running without started", state: running, want: true},
+		{name: "terminated without started", state: terminated, want: true},
+		{name: "waiting without started", state: waiting, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+				Status: corev1.PodStatus{
+					ContainerStatuses: []corev1.ContainerStatus{{Name: "app", Started: tt.started, State: tt.state}},
+				},
+			}
+			if got, _ := evaluateContainer(pod, "app", ContainerStarted); got != tt.want {
+				t.Errorf("evaluateContainer() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
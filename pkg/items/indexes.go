@@ -0,0 +1,140 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package items
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxIndex is the largest completion index, indexes are int32 in the Job API.
+const maxIndex = math.MaxInt32
+
+// IndexSet is a set of completion indexes of an Indexed Job in the form of status.completedIndexes, e.g. 1,3-5,7.
+type IndexSet []indexRange
+
+type indexRange struct {
+	first int
+	last  int
+}
+
+// ParseIndexSet parses a comma separated list of indexes and ranges of indexes (e.g. 1,3-5,7), the empty string is the empty set.
+// The set is sorted and overlapping ranges are merged.
+func ParseIndexSet(value string) (IndexSet, error) {
+	set := IndexSet{}
+	if value == "" {
+		return set, nil
+	}
+	for _, part := range strings.Split(value, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		r := indexRange{}
+		var err error
+		if r.first, err = strconv.Atoi(first); err != nil || r.first < 0 || r.first > maxIndex {
+			return nil, fmt.Errorf("expected an index or a range of indexes, got '%s'", part)
+		}
+		r.last = r.first
+		if isRange {
+			if r.last, err = strconv.Atoi(last); err != nil || r.last < r.first || r.last > maxIndex {
+				return nil, fmt.Errorf("expected an index or a range of indexes, got '%s'", part)
+			}
+		}
+		set = append(set, r)
+	}
+	return set.normalize(), nil
+}
+
+// Contains returns true when the index is in the set.
+func (s IndexSet) Contains(index int) bool {
+	for _, r := range s {
+		if index >= r.first && index <= r.last {
+			return true
+		}
+	}
+	return false
+}
+
+// Without returns the indexes of the set that are not in the other set.
+func (s IndexSet) Without(other IndexSet) IndexSet {
+	other = other.normalize()
+	result := IndexSet{}
+	for _, r := range s.normalize() {
+		next := r.first
+		for _, o := range other {
+			if o.last < next || o.first > r.last {
+				continue
+			}
+			if o.first > next {
+				result = result.add(indexRange{first: next, last: o.first - 1})
+			}
+			next = o.last + 1
+		}
+		if next <= r.last {
+			result = result.add(indexRange{first: next, last: r.last})
+		}
+	}
+	return result
+}
+
+// Intersect returns the indexes of the set that are also in the other set.
+func (s IndexSet) Intersect(other IndexSet) IndexSet {
+	other = other.normalize()
+	result := IndexSet{}
+	for _, r := range s.normalize() {
+		for _, o := range other {
+			if first, last := max(r.first, o.first), min(r.last, o.last); first <= last {
+				result = result.add(indexRange{first: first, last: last})
+			}
+		}
+	}
+	return result
+}
+
+// normalize returns the ranges of the set sorted, with overlapping and adjacent ranges merged.
+func (s IndexSet) normalize() IndexSet {
+	sorted := slices.Clone(s)
+	slices.SortFunc(sorted, func(a, b indexRange) int { return a.first - b.first })
+	result := IndexSet{}
+	for _, r := range sorted {
+		result = result.add(r)
+	}
+	return result
+}
+
+// add appends a range that does not start before the last range of the set, merging it when they overlap or are adjacent.
+func (s IndexSet) add(r indexRange) IndexSet {
+	if n := len(s); n > 0 && r.first <= s[n-1].last+1 {
+		s[n-1].last = max(s[n-1].last, r.last)
+		return s
+	}
+	return append(s, r)
+}
+
+// String returns the set in the form it is parsed from.
+func (s IndexSet) String() string {
+	parts := make([]string, 0, len(s))
+	for _, r := range s {
+		if r.first == r.last {
+			parts = append(parts, strconv.Itoa(r.first))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", r.first, r.last))
+		}
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,157 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package items
+
+import (
+	"strconv"
+	"testing"
+)
+
+func mustParseIndexSet(t *testing.T, value string) IndexSet {
+	t.Helper()
+	set, err := ParseIndexSet(value)
+	if err != nil {
+		t.Fatalf("ParseIndexSet(%q) failed: %v", value, err)
+	}
+	return set
+}
+
+func TestParseIndexSet(t *testing.T) {
+	maxValue := strconv.Itoa(maxIndex)
+	tests := []struct {
+		value string
+		want  string
+		err   bool
+	}{
+		{value: "", want: ""},
+		{value: "1,3-5,7", want: "1,3-5,7"},
+		{value: "7,1,3-5", want: "1,3-5,7"},
+		{value: "1-4,3-6", want: "1-6"},
+		{value: "1-3,4-6", want: "1-6"},
+		{value: "1,2,3", want: "1-3"},
+		{value: "1-6,2-3", want: "1-6"},
+		{value: "1-3,5-6", want: "1-3,5-6"},
+		{value: "0-" + maxValue, want: "0-" + maxValue},
+		{value: maxValue, want: maxValue},
+		{value: strconv.Itoa(maxIndex + 1), err: true},
+		{value: "0-" + strconv.Itoa(maxIndex+1), err: true},
+		{value: "-1", err: true},
+		{value: "5-3", err: true},
+		{value: "1,,2", err: true},
+		{value: "a", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			set, err := ParseIndexSet(tt.value)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", set)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := set.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexSetWithout(t *testing.T) {
+	maxValue := strconv.Itoa(maxIndex)
+	tests := []struct {
+		set   string
+		other string
+		want  string
+	}{
+		{set: "0-9", other: "", want: "0-9"},
+		{set: "", other: "0-9", want: ""},
+		{set: "0-9", other: "0-9", want: ""},
+		{set: "0-9", other: "3-5", want: "0-2,6-9"},
+		{set: "0-9", other: "0", want: "1-9"},
+		{set: "0-9", other: "9", want: "0-8"},
+		{set: "0-9", other: "2,4,6", want: "0-1,3,5,7-9"},
+		{set: "0-9", other: "3-4,5-6", want: "0-2,7-9"},
+		{set: "3-5", other: "0-2,6-9", want: "3-5"},
+		{set: "0-2,6-9", other: "1-7", want: "0,8-9"},
+		{set: "0-" + maxValue, other: "1-" + maxValue, want: "0"},
+		{set: "0-" + maxValue, other: maxValue, want: "0-" + strconv.Itoa(maxIndex-1)},
+		{set: maxValue, other: "0-" + maxValue, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.set+" without "+tt.other, func(t *testing.T) {
+			got := mustParseIndexSet(t, tt.set).Without(mustParseIndexSet(t, tt.other))
+			if got.String() != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexSetIntersect(t *testing.T) {
+	maxValue := strconv.Itoa(maxIndex)
+	tests := []struct {
+		set   string
+		other string
+		want  string
+	}{
+		{set: "0-9", other: "", want: ""},
+		{set: "0-9", other: "3-5", want: "3-5"},
+		{set: "0-4", other: "5-9", want: ""},
+		{set: "0-5", other: "5-9", want: "5"},
+		{set: "0-2,6-9", other: "1-7", want: "1-2,6-7"},
+		{set: "1,3,5", other: "2-4", want: "3"},
+		{set: "0-3", other: "1,2", want: "1-2"},
+		{set: "0-" + maxValue, other: maxValue, want: maxValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.set+" intersect "+tt.other, func(t *testing.T) {
+			got := mustParseIndexSet(t, tt.set).Intersect(mustParseIndexSet(t, tt.other))
+			if got.String() != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexSetNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		set  IndexSet
+		want string
+	}{
+		{name: "empty", set: IndexSet{}, want: ""},
+		{name: "unsorted", set: IndexSet{{first: 5, last: 6}, {first: 1, last: 2}}, want: "1-2,5-6"},
+		{name: "overlapping", set: IndexSet{{first: 1, last: 4}, {first: 3, last: 6}}, want: "1-6"},
+		{name: "adjacent", set: IndexSet{{first: 4, last: 6}, {first: 1, last: 3}}, want: "1-6"},
+		{name: "contained", set: IndexSet{{first: 1, last: 9}, {first: 2, last: 3}}, want: "1-9"},
+		{name: "maxIndex", set: IndexSet{{first: maxIndex, last: maxIndex}, {first: 0, last: maxIndex - 1}}, want: "0-" + strconv.Itoa(maxIndex)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := tt.set.String()
+			if got := tt.set.normalize().String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if tt.set.String() != original {
+				t.Errorf("normalize changed the set to %s", tt.set)
+			}
+		})
+	}
+}
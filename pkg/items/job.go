@@ -17,19 +17,72 @@
 package items
 
 import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/erayan/k8s-wait-for-multi/pkg/conditions"
 	"github.com/erayan/k8s-wait-for-multi/utils"
 
 	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
+// JobMissingPolicy decides what a job that does not exist means, e.g. because it was removed by its ttlSecondsAfterFinished.
+type JobMissingPolicy string
+
+const (
+	JobMissingComplete JobMissingPolicy = "complete"
+	JobMissingWait     JobMissingPolicy = "wait"
+	JobMissingFail     JobMissingPolicy = "fail"
+)
+
+var jobMissingPolicies = []JobMissingPolicy{JobMissingComplete, JobMissingWait, JobMissingFail}
+
+// ParseJobMissingPolicy parses one of complete, wait or fail.
+func ParseJobMissingPolicy(value string) (JobMissingPolicy, error) {
+	policy := JobMissingPolicy(value)
+	if !slices.Contains(jobMissingPolicies, policy) {
+		return "", fmt.Errorf("expected one of %v, got '%s'", jobMissingPolicies, value)
+	}
+	return policy, nil
+}
+
 type NamespacedJobCollection map[string]JobCollection
 
 type JobCollection map[string]*JobItem
 
 type JobItem struct {
+	itemStatus
+
 	namespace string
 	name      string
 	complete  bool
+
+	// uid and createdAt identify the run of the job, a job that is deleted and created again gets a new uid.
+	uid       types.UID
+	createdAt time.Time
+	// notBefore makes jobs that were created before it outdated, they are neither complete nor failed. Zero allows any job.
+	notBefore time.Time
+	outdated  bool
+
+	missing JobMissingPolicy
+
+	// active, succeeded and failed count the pods of the job, completions is nil for jobs that are done when any pod succeeded.
+	active      int32
+	succeeded   int32
+	failed      int32
+	completions *int32
+	indexed     bool
+	// completedIndexes and failedIndexes are only set for Indexed Jobs.
+	completedIndexes IndexSet
+	failedIndexes    IndexSet
+	// successCriteriaMet is set while the job met its successPolicy but is not Complete yet because its remaining pods are terminating.
+	successCriteriaMet bool
+
+	// indexes makes the job complete once these indexes completed, instead of once the job is Complete.
+	indexes IndexSet
 }
 
 func Job(ns string, n string) *JobItem {
@@ -40,16 +93,118 @@ func Job(ns string, n string) *JobItem {
 	}
 }
 
+func (i *JobItem) WithCondition(condition conditions.Condition) *JobItem {
+	i.condition = condition
+	return i
+}
+
 func (i *JobItem) WithComplete(complete bool) *JobItem {
 	i.complete = complete
 	return i
 }
 
+// WithNotBefore requires the job to be created at or after the time, older jobs are outdated.
+func (i *JobItem) WithNotBefore(notBefore time.Time) *JobItem {
+	i.notBefore = notBefore
+	return i
+}
+
+// WithIndexes makes the job complete once the indexes completed, which needs an Indexed Job.
+func (i *JobItem) WithIndexes(indexes IndexSet) *JobItem {
+	i.indexes = indexes
+	return i
+}
+
+// WithMissingPolicy sets what it means when the job does not exist, see JobMissingPolicy.
+func (i *JobItem) WithMissingPolicy(policy JobMissingPolicy) *JobItem {
+	i.missing = policy
+	return i
+}
+
+// WithAbsent marks the job as not existing, which makes it complete when waiting for its deletion and otherwise depends on the JobMissingPolicy.
+// The uid is kept to recognize the job when it was deleted and created again.
+func (i *JobItem) WithAbsent() *JobItem {
+	i.complete = i.absent()
+	i.outdated = false
+	if !i.WaitsForDeletion() {
+		switch i.missing {
+		case JobMissingComplete:
+			i.complete = true
+		case JobMissingFail:
+			i.failure = "not found"
+		}
+	}
+	return i
+}
+
+// WithDeleted marks the run of the job with the uid as deleted. A run that was observed complete stays complete,
+// e.g. when it is removed by ttlSecondsAfterFinished, unless the job is waited for to be deleted.
+func (i *JobItem) WithDeleted(uid types.UID) *JobItem {
+	if i.complete && !i.outdated && !i.WaitsForDeletion() && uid != "" && uid == i.uid {
+		return i
+	}
+	return i.WithAbsent()
+}
+
 func (i *JobItem) WithCompleteFromJob(job *batchv1.Job) *JobItem {
-	i.complete = utils.IsJobStatusConditionTrue(job.Status.Conditions, batchv1.JobComplete)
+	met := i.observe(job)
+	i.uid = job.UID
+	i.createdAt = job.CreationTimestamp.Time
+	// the creation timestamp is only precise to the second
+	i.outdated = !i.notBefore.IsZero() && !i.WaitsForDeletion() && i.createdAt.Before(i.notBefore.Truncate(time.Second))
+	if i.outdated {
+		i.complete = false
+		i.failure = ""
+		return i
+	}
+
+	i.active = job.Status.Active
+	i.succeeded = job.Status.Succeeded
+	i.failed = job.Status.Failed
+	i.completions = job.Spec.Completions
+	i.indexed = job.Spec.CompletionMode != nil && *job.Spec.CompletionMode == batchv1.IndexedCompletion
+	// the indexes are written by the job controller, an unexpected format only hides them
+	i.completedIndexes, _ = ParseIndexSet(job.Status.CompletedIndexes)
+	i.failedIndexes = nil
+	if job.Status.FailedIndexes != nil {
+		i.failedIndexes, _ = ParseIndexSet(*job.Status.FailedIndexes)
+	}
+
+	complete := utils.IsJobStatusConditionTrue(job.Status.Conditions, batchv1.JobComplete)
+	i.successCriteriaMet = !complete && utils.IsJobStatusConditionTrue(job.Status.Conditions, batchv1.JobSuccessCriteriaMet)
+
+	if i.condition != nil {
+		i.complete = met
+	} else if len(i.indexes) > 0 {
+		i.complete = len(i.indexes.Without(i.completedIndexes)) == 0
+		i.failure = ""
+		if !i.complete {
+			i.failure = i.getIndexesFailure(job, complete)
+		}
+	} else {
+		i.complete = complete || i.successCriteriaMet
+		i.failure = utils.GetJobFailure(job)
+	}
 	return i
 }
 
+// getIndexesFailure returns why the indexes that are waited for will never complete, or the empty string.
+func (i *JobItem) getIndexesFailure(job *batchv1.Job, complete bool) string {
+	if !i.indexed {
+		return fmt.Sprintf("indexes %s are waited for, but the job is not Indexed", i.indexes)
+	}
+	if failed := i.indexes.Intersect(i.failedIndexes); len(failed) > 0 {
+		return fmt.Sprintf("indexes %s failed", failed)
+	}
+	if failure := utils.GetJobFailure(job); failure != "" {
+		return failure
+	}
+	if complete || i.successCriteriaMet {
+		return fmt.Sprintf("the job succeeded without completing indexes %s", i.indexes.Without(i.completedIndexes))
+	}
+	return ""
+}
+
 func (i *JobItem) GetName() string {
 	return i.name
 }
@@ -62,6 +217,58 @@ func (i *JobItem) IsComplete() bool {
 	return i.complete
 }
 
+// GetUID returns the uid of the job that was seen last, it is kept when the job was deleted.
+func (i *JobItem) GetUID() types.UID {
+	return i.uid
+}
+
+// HasIndexes returns true when the job is complete once specific indexes completed.
+func (i *JobItem) HasIndexes() bool {
+	return len(i.indexes) > 0
+}
+
+// GetIndexes returns the indexes that are waited for.
+func (i *JobItem) GetIndexes() IndexSet {
+	return i.indexes
+}
+
+// IsSuccessCriteriaMet returns true while the job met its successPolicy but is not Complete yet.
+func (i *JobItem) IsSuccessCriteriaMet() bool {
+	return i.successCriteriaMet
+}
+
+// GetProgress describes the pods of the job, e.g. 2/5 succeeded, 1 active, completed indexes: 0-1.
+// It is empty while the job does not exist.
+func (i *JobItem) GetProgress() string {
+	if !i.exists || i.outdated {
+		return ""
+	}
+	parts := []string{}
+	if i.completions != nil {
+		parts = append(parts, fmt.Sprintf("%d/%d succeeded", i.succeeded, *i.completions))
+	} else {
+		parts = append(parts, fmt.Sprintf("%d succeeded", i.succeeded))
+	}
+	if i.active > 0 {
+		parts = append(parts, fmt.Sprintf("%d active", i.active))
+	}
+	if i.failed > 0 {
+		parts = append(parts, fmt.Sprintf("%d failed", i.failed))
+	}
+	if i.indexed && len(i.completedIndexes) > 0 {
+		parts = append(parts, fmt.Sprintf("completed indexes: %s", i.completedIndexes))
+	}
+	if waiting := i.indexes.Without(i.completedIndexes); len(waiting) > 0 {
+		parts = append(parts, fmt.Sprintf("waiting for indexes: %s", waiting))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// IsOutdated returns true when the job was created before the time set with WithNotBefore.
+func (i *JobItem) IsOutdated() bool {
+	return i.outdated
+}
+
 func (c NamespacedJobCollection) EnsureNamespace(ns string) {
 	if _, ok := c[ns]; !ok {
 		c[ns] = JobCollection{}
@@ -85,14 +292,3 @@ func (c NamespacedJobCollection) TotalCount() int {
 	}
 	return count
 }
-
-func (c NamespacedJobCollection) AreAllComplete() bool {
-	for _, items := range c {
-		for _, item := range items {
-			if !item.complete {
-				return false
-			}
-		}
-	}
-	return true
-}
@@ -0,0 +1,63 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package items
+
+import (
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestJobWithDeleted(t *testing.T) {
+	completeJob := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "migrate", UID: "run-1"},
+		Status: batchv1.JobStatus{
+			Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}},
+		},
+	}
+	runningJob := completeJob.DeepCopy()
+	runningJob.Status.Conditions = nil
+
+	tests := []struct {
+		name     string
+		job      *batchv1.Job
+		missing  JobMissingPolicy
+		uid      types.UID
+		complete bool
+		failure  string
+	}{
+		{name: "complete run deleted by ttl", job: completeJob, missing: JobMissingWait, uid: "run-1", complete: true},
+		{name: "complete run deleted with fail policy", job: completeJob, missing: JobMissingFail, uid: "run-1", complete: true},
+		{name: "running run deleted", job: runningJob, missing: JobMissingWait, uid: "run-1"},
+		{name: "running run deleted with fail policy", job: runningJob, missing: JobMissingFail, uid: "run-1", failure: "not found"},
+		{name: "deleted without uid", job: completeJob, missing: JobMissingWait, uid: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := Job("default", "migrate").WithMissingPolicy(tt.missing).WithCompleteFromJob(tt.job).WithDeleted(tt.uid)
+			if item.IsComplete() != tt.complete {
+				t.Errorf("IsComplete() = %v, want %v", item.IsComplete(), tt.complete)
+			}
+			if item.GetFailure() != tt.failure {
+				t.Errorf("GetFailure() = %q, want %q", item.GetFailure(), tt.failure)
+			}
+		})
+	}
+}
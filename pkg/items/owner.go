@@ -0,0 +1,171 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package items
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type NamespacedOwnerCollection map[string]OwnerCollection
+
+// OwnerCollection is keyed by the owner reference string as returned by OwnerItem.GetName.
+type OwnerCollection map[string]*OwnerItem
+
+// OwnerItem tracks all pods that are (transitively) owned by an object of an arbitrary kind.
+type OwnerItem struct {
+	namespace string
+	kind      string
+	group     string
+	name      string
+	children  PodCollection
+	threshold Threshold
+	rules     FailureRules
+}
+
+// Owner creates an OwnerItem from a reference in the form KIND/NAME or KIND.GROUP/NAME.
+func Owner(ns string, ref string) (*OwnerItem, error) {
+	kind, name, found := strings.Cut(ref, "/")
+	if !found || kind == "" || name == "" {
+		return nil, fmt.Errorf("owner reference '%s' is not in the form KIND/NAME", ref)
+	}
+	kind, group, _ := strings.Cut(kind, ".")
+	return &OwnerItem{
+		namespace: ns,
+		kind:      strings.ToLower(kind),
+		group:     strings.ToLower(group),
+		name:      name,
+		children:  PodCollection{},
+	}, nil
+}
+
+// Matches returns true when the owner reference points at the object this item tracks.
+func (i *OwnerItem) Matches(ref metav1.OwnerReference) bool {
+	if ref.Name != i.name || strings.ToLower(ref.Kind) != i.kind {
+		return false
+	}
+	if i.group == "" {
+		return true
+	}
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return false
+	}
+	return strings.ToLower(gv.Group) == i.group
+}
+
+func (i *OwnerItem) GetChildren() *PodCollection {
+	return &i.children
+}
+
+func (i *OwnerItem) WithChild(pod *PodItem) *OwnerItem {
+	i.children[pod.GetName()] = pod
+	return i
+}
+
+// WithFailureRules sets when the owned pods fail because they will never become ready.
+func (i *OwnerItem) WithFailureRules(rules FailureRules) *OwnerItem {
+	i.rules = rules
+	return i
+}
+
+// GetFailureRules returns when the owned pods fail because they will never become ready.
+func (i *OwnerItem) GetFailureRules() FailureRules {
+	return i.rules
+}
+
+// WithThreshold sets how many owned pods need to be ready for the owner to be available.
+func (i *OwnerItem) WithThreshold(threshold Threshold) *OwnerItem {
+	i.threshold = threshold
+	return i
+}
+
+// GetThreshold returns how many owned pods need to be ready for the owner to be available.
+func (i *OwnerItem) GetThreshold() Threshold {
+	return i.threshold
+}
+
+// IsAvailable returns true when enough owned pods are ready, see WithThreshold.
+func (i *OwnerItem) IsAvailable() bool {
+	return i.children.IsThresholdMet(i.threshold)
+}
+
+// GetName returns the owner reference in the form KIND/NAME or KIND.GROUP/NAME.
+func (i *OwnerItem) GetName() string {
+	if i.group == "" {
+		return fmt.Sprintf("%s/%s", i.kind, i.name)
+	}
+	return fmt.Sprintf("%s.%s/%s", i.kind, i.group, i.name)
+}
+
+func (i *OwnerItem) GetNamespace() string {
+	return i.namespace
+}
+
+func (i *OwnerItem) GetPod(pod ItemInterface) (*PodItem, bool) {
+	val, ok := i.children[pod.GetName()]
+	return val, ok
+}
+
+func (c OwnerItem) DeletePod(i ItemInterface) {
+	if c.namespace == i.GetNamespace() {
+		delete(c.children, i.GetName())
+	}
+}
+
+func (c OwnerCollection) DeletePod(i ItemInterface) {
+	for _, owner := range c {
+		owner.DeletePod(i)
+	}
+}
+
+func (c NamespacedOwnerCollection) DeletePod(i ItemInterface) {
+	if owners, ok := c[i.GetNamespace()]; ok {
+		owners.DeletePod(i)
+	}
+}
+
+func (c NamespacedOwnerCollection) EnsureNamespace(ns string) {
+	if _, ok := c[ns]; !ok {
+		c[ns] = OwnerCollection{}
+	}
+}
+
+func (c NamespacedOwnerCollection) ContainsNamespacedName(ns string, n string) bool {
+	_, ok := c[ns][n]
+	return ok
+}
+
+func (c NamespacedOwnerCollection) ContainsPod(i ItemInterface) bool {
+	for _, owner := range c[i.GetNamespace()] {
+		if owner.children.Contains(i) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c NamespacedOwnerCollection) TotalCount() int {
+	count := 0
+	for _, items := range c {
+		count += len(items)
+	}
+	return count
+}
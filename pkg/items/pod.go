@@ -17,9 +17,17 @@
 package items
 
 import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/erayan/k8s-wait-for-multi/pkg/conditions"
+
 	"k8s.io/kubectl/pkg/util/podutils"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 type NamespacedPodCollection map[string]PodCollection
@@ -27,9 +35,32 @@ type NamespacedPodCollection map[string]PodCollection
 type PodCollection map[string]*PodItem
 
 type PodItem struct {
+	itemStatus
+
 	namespace string
 	name      string
 	ready     bool
+
+	// container is set when a single container of the pod is waited for instead of the whole pod.
+	container          string
+	containerCondition ContainerCondition
+	containers         []ContainerState
+
+	// problems describes the containers that keep the pod from being ready, e.g. app: CrashLoopBackOff.
+	problems string
+	// waiting describes the containers that are still starting, e.g. app: ContainerCreating.
+	waiting string
+	// phase and the number of ready containers describe the pod while it is not ready.
+	phase           corev1.PodPhase
+	readyContainers int
+	containerCount  int
+
+	rules FailureRules
+
+	uid types.UID
+	// unschedulableSince is set while the PodScheduled condition is false because the pod can not be scheduled.
+	unschedulableSince   time.Time
+	unschedulableMessage string
 }
 
 func Pod(ns string, n string) *PodItem {
@@ -40,13 +71,71 @@ func Pod(ns string, n string) *PodItem {
 	}
 }
 
+func (i *PodItem) WithCondition(condition conditions.Condition) *PodItem {
+	i.condition = condition
+	return i
+}
+
+// WithContainer waits for the condition of a single container instead of the readiness of the pod.
+func (i *PodItem) WithContainer(container string, condition ContainerCondition) *PodItem {
+	i.container = container
+	i.containerCondition = condition
+	return i
+}
+
+// WithFailureRules sets when the pod fails because it will never become ready.
+func (i *PodItem) WithFailureRules(rules FailureRules) *PodItem {
+	i.rules = rules
+	return i
+}
+
 func (i *PodItem) WithReady(ready bool) *PodItem {
 	i.ready = ready
 	return i
 }
 
+// WithAbsent marks the pod as not existing, which only makes it ready when waiting for its deletion.
+func (i *PodItem) WithAbsent() *PodItem {
+	i.ready = i.absent()
+	i.containers = nil
+	i.problems = ""
+	i.waiting = ""
+	i.phase = ""
+	i.readyContainers = 0
+	i.containerCount = 0
+	i.uid = ""
+	i.unschedulableSince = time.Time{}
+	i.unschedulableMessage = ""
+	return i
+}
+
 func (i *PodItem) WithReadyFromPod(pod *corev1.Pod) *PodItem {
-	i.ready = podutils.IsPodReady(pod)
+	met := i.observe(pod)
+	if i.container != "" {
+		i.containers = getContainerStates(pod)
+		i.ready, i.failure = evaluateContainer(pod, i.container, i.containerCondition)
+	} else if i.condition != nil {
+		i.ready = met
+	} else {
+		i.ready = podutils.IsPodReady(pod)
+	}
+
+	i.uid = pod.UID
+	i.problems = getPodProblems(pod)
+	i.waiting = getPodWaiting(pod)
+	i.phase = pod.Status.Phase
+	i.readyContainers = 0
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Ready {
+			i.readyContainers++
+		}
+	}
+	i.containerCount = len(pod.Spec.Containers)
+	i.unschedulableSince, i.unschedulableMessage = getUnschedulable(pod)
+	// pods that are waited for to be deleted do not fail when their containers do
+	if !i.ready && i.failure == "" && !i.WaitsForDeletion() {
+		i.failure = i.rules.check(pod)
+	}
 	return i
 }
 
@@ -54,6 +143,57 @@ func (i *PodItem) GetName() string {
 	return i.name
 }
 
+// GetFailure returns why the pod will never be done, which includes being unschedulable for longer than the UnschedulableTimeout.
+func (i *PodItem) GetFailure() string {
+	if i.failure == "" && !i.ready && !i.WaitsForDeletion() {
+		return i.rules.checkUnschedulable(i.unschedulableSince, i.unschedulableMessage, time.Now())
+	}
+	return i.failure
+}
+
+// GetUID returns the uid of the pod when it exists.
+func (i *PodItem) GetUID() types.UID {
+	return i.uid
+}
+
+// GetUnschedulable returns since when the pod could not be scheduled and why, the time is zero when it is not unschedulable.
+func (i *PodItem) GetUnschedulable() (time.Time, string) {
+	return i.unschedulableSince, i.unschedulableMessage
+}
+
+// GetDetails describes the pod while it is not ready, e.g. Running, 1/2 containers ready, app: CrashLoopBackOff (5 restarts).
+// It is empty while the pod does not exist.
+func (i *PodItem) GetDetails() string {
+	details := []string{}
+	if i.phase != "" {
+		details = append(details, string(i.phase))
+	}
+	if i.containerCount > 0 {
+		details = append(details, fmt.Sprintf("%d/%d containers ready", i.readyContainers, i.containerCount))
+	}
+	if i.problems != "" {
+		details = append(details, i.problems)
+	} else if i.waiting != "" {
+		details = append(details, i.waiting)
+	}
+	return strings.Join(details, ", ")
+}
+
+// GetContainer returns the container that is waited for, or the empty string when the whole pod is.
+func (i *PodItem) GetContainer() string {
+	return i.container
+}
+
+// GetContainerCondition returns what the container is waited for.
+func (i *PodItem) GetContainerCondition() ContainerCondition {
+	return i.containerCondition
+}
+
+// GetContainerStates returns the states of all containers of the pod when a single container is waited for.
+func (i *PodItem) GetContainerStates() []ContainerState {
+	return i.containers
+}
+
 func (i *PodItem) GetNamespace() string {
 	return i.namespace
 }
@@ -81,26 +221,57 @@ func (c PodCollection) ContainsName(n string) bool {
 	return ok
 }
 
+// GetForPod returns the items of the pod, that is the pod itself and every container of it that is waited for.
+func (c NamespacedPodCollection) GetForPod(meta ItemInterface) []*PodItem {
+	items := []*PodItem{}
+	for _, item := range c[meta.GetNamespace()] {
+		if item.name == meta.GetName() {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func (c NamespacedPodCollection) ContainsNamespacedName(ns string, n string) bool {
 	_, ok := c[ns][n]
 	return ok
 }
 
-func (c NamespacedPodCollection) TotalCount() int {
+// CountReady returns how many pods in the collection are ready.
+func (c PodCollection) CountReady() int {
 	count := 0
-	for _, items := range c {
-		count += len(items)
+	for _, item := range c {
+		if item.ready {
+			count++
+		}
 	}
 	return count
 }
 
-func (c NamespacedPodCollection) AreAllReady() bool {
-	for _, items := range c {
-		for _, item := range items {
-			if !item.ready {
-				return false
-			}
+// GetFailure returns the failure of the first pod (by name) when too many pods failed to still meet the threshold, or the empty string.
+func (c PodCollection) GetFailure(threshold Threshold) string {
+	failed := []string{}
+	for name, item := range c {
+		if item.GetFailure() != "" {
+			failed = append(failed, name)
 		}
 	}
-	return true
+	if len(failed) == 0 || len(c)-len(failed) >= threshold.Required(len(c)) {
+		return ""
+	}
+	slices.Sort(failed)
+	return fmt.Sprintf("pod/%s: %s", failed[0], c[failed[0]].GetFailure())
+}
+
+// IsThresholdMet returns true when enough pods in the collection are ready.
+func (c PodCollection) IsThresholdMet(threshold Threshold) bool {
+	return c.CountReady() >= threshold.Required(len(c))
+}
+
+func (c NamespacedPodCollection) TotalCount() int {
+	count := 0
+	for _, items := range c {
+		count += len(items)
+	}
+	return count
 }
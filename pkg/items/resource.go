@@ -0,0 +1,161 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package items
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/erayan/k8s-wait-for-multi/pkg/conditions"
+	"github.com/erayan/k8s-wait-for-multi/utils"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/kubectl/pkg/polymorphichelpers"
+)
+
+// readyConditionTypes are checked in order, the first one present on a resource decides if it is ready.
+var readyConditionTypes = []string{"Ready", "Available", "Established"}
+
+// NamespacedResourceCollection is keyed by namespace, cluster-scoped resources use the empty namespace.
+type NamespacedResourceCollection map[string]ResourceCollection
+
+// ResourceCollection is keyed by KIND.GROUP/NAME as returned by ResourceItem.GetKey.
+type ResourceCollection map[string]*ResourceItem
+
+// ResourceItem tracks an object of any kind other than pod, service or job.
+type ResourceItem struct {
+	itemStatus
+
+	namespace string
+	name      string
+	gvk       schema.GroupVersionKind
+	ready     bool
+}
+
+func Resource(ns string, n string, gvk schema.GroupVersionKind) *ResourceItem {
+	return &ResourceItem{
+		namespace: ns,
+		name:      n,
+		gvk:       gvk,
+		ready:     false,
+	}
+}
+
+func (i *ResourceItem) WithCondition(condition conditions.Condition) *ResourceItem {
+	i.condition = condition
+	return i
+}
+
+func (i *ResourceItem) WithReady(ready bool) *ResourceItem {
+	i.ready = ready
+	return i
+}
+
+// WithAbsent marks the resource as not existing, which only makes it ready when waiting for its deletion.
+func (i *ResourceItem) WithAbsent() *ResourceItem {
+	i.ready = i.absent()
+	return i
+}
+
+// WithReadyFromObject uses the custom condition when set, then the rollout status for workloads kubectl knows about
+// (e.g. Deployments and StatefulSets), otherwise the first condition in readyConditionTypes that is present.
+// Resources without any of those are ready when they exist. Without a custom condition, workloads of which the rollout
+// can not make progress anymore (e.g. ProgressDeadlineExceeded) fail.
+func (i *ResourceItem) WithReadyFromObject(obj *unstructured.Unstructured) *ResourceItem {
+	met := i.observe(obj)
+	if i.condition != nil {
+		i.ready = met
+		return i
+	}
+
+	i.failure = utils.GetUnstructuredWorkloadFailure(obj)
+
+	if viewer, err := polymorphichelpers.StatusViewerFor(i.gvk.GroupKind()); err == nil {
+		_, done, err := viewer.Status(obj, 0)
+		i.ready = err == nil && done
+		return i
+	}
+
+	for _, conditionType := range readyConditionTypes {
+		if status, _, found := utils.GetUnstructuredStatusCondition(obj, conditionType); found {
+			i.ready = status == "True"
+			return i
+		}
+	}
+
+	i.ready = true
+	return i
+}
+
+// GetName returns the lowercase kind and the name in the form KIND/NAME.
+func (i *ResourceItem) GetName() string {
+	return fmt.Sprintf("%s/%s", strings.ToLower(i.gvk.Kind), i.name)
+}
+
+// GetKey returns the key of the item in a ResourceCollection.
+func (i *ResourceItem) GetKey() string {
+	return ResourceKey(i.gvk, i.name)
+}
+
+// GetObjectName returns the name of the object without its kind.
+func (i *ResourceItem) GetObjectName() string {
+	return i.name
+}
+
+func (i *ResourceItem) GetNamespace() string {
+	return i.namespace
+}
+
+func (i *ResourceItem) GetGroupVersionKind() schema.GroupVersionKind {
+	return i.gvk
+}
+
+func (i *ResourceItem) IsReady() bool {
+	return i.ready
+}
+
+// ResourceKey returns the key used for a resource in a ResourceCollection, the group is part of it so that kinds
+// with the same name in different groups do not collide, e.g. service.serving.knative.dev/hello.
+func ResourceKey(gvk schema.GroupVersionKind, name string) string {
+	return fmt.Sprintf("%s/%s", strings.ToLower(gvk.GroupKind().String()), name)
+}
+
+func (c NamespacedResourceCollection) EnsureNamespace(ns string) {
+	if _, ok := c[ns]; !ok {
+		c[ns] = ResourceCollection{}
+	}
+}
+
+func (c NamespacedResourceCollection) ContainsNamespacedName(ns string, n string) bool {
+	_, ok := c[ns][n]
+	return ok
+}
+
+// Get returns the item for the object, the object needs to have its kind set.
+func (c NamespacedResourceCollection) Get(obj *unstructured.Unstructured) (*ResourceItem, bool) {
+	val, ok := c[obj.GetNamespace()][ResourceKey(obj.GroupVersionKind(), obj.GetName())]
+	return val, ok
+}
+
+func (c NamespacedResourceCollection) TotalCount() int {
+	count := 0
+	for _, items := range c {
+		count += len(items)
+	}
+	return count
+}
@@ -0,0 +1,137 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package items
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// FailureRules decide when a pod that is not ready will never become ready, so waiting for it fails right away.
+// The zero value never fails.
+type FailureRules struct {
+	// FatalReasons are the waiting or terminated reasons of a container that fail the pod, e.g. CrashLoopBackOff or ImagePullBackOff.
+	FatalReasons []string
+	// RestartLimit fails the pod when any of its containers restarted that many times, zero disables it.
+	RestartLimit int32
+	// UnschedulableTimeout fails the pod when it could not be scheduled for that long, zero disables it.
+	UnschedulableTimeout time.Duration
+}
+
+// check returns why the pod failed according to the rules, or the empty string.
+func (r FailureRules) check(pod *corev1.Pod) string {
+	for _, status := range getContainerStatuses(pod) {
+		if reason := getContainerReason(status); reason != "" && slices.Contains(r.FatalReasons, reason) {
+			return describeContainerProblem(status)
+		}
+		if r.RestartLimit > 0 && status.RestartCount >= r.RestartLimit {
+			return fmt.Sprintf("%s, restart limit of %d reached", describeContainerProblem(status), r.RestartLimit)
+		}
+	}
+	return ""
+}
+
+// checkUnschedulable returns why the pod failed when it could not be scheduled for longer than the UnschedulableTimeout, or the empty string.
+func (r FailureRules) checkUnschedulable(since time.Time, message string, now time.Time) string {
+	if r.UnschedulableTimeout == 0 || since.IsZero() || now.Sub(since) < r.UnschedulableTimeout {
+		return ""
+	}
+	if message == "" {
+		return fmt.Sprintf("Unschedulable for more than %s", r.UnschedulableTimeout)
+	}
+	return fmt.Sprintf("Unschedulable for more than %s: %s", r.UnschedulableTimeout, message)
+}
+
+// getUnschedulable returns since when the pod could not be scheduled and why, the time is zero when it is not unschedulable.
+func getUnschedulable(pod *corev1.Pod) (time.Time, string) {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse && condition.Reason == corev1.PodReasonUnschedulable {
+			if condition.LastTransitionTime.IsZero() {
+				return pod.CreationTimestamp.Time, condition.Message
+			}
+			return condition.LastTransitionTime.Time, condition.Message
+		}
+	}
+	return time.Time{}, ""
+}
+
+// getPodProblems describes the containers of the pod that are waiting for another reason than being created,
+// or that terminated unsuccessfully, e.g. app: CrashLoopBackOff (exited with 1, 5 restarts).
+func getPodProblems(pod *corev1.Pod) string {
+	problems := []string{}
+	for _, status := range getContainerStatuses(pod) {
+		switch reason := getContainerReason(status); reason {
+		case "", "ContainerCreating", "PodInitializing", "Completed":
+			continue
+		}
+		problems = append(problems, describeContainerProblem(status))
+	}
+	return strings.Join(problems, ", ")
+}
+
+// getPodWaiting describes the containers that are still starting, e.g. app: ContainerCreating, which are not problems.
+func getPodWaiting(pod *corev1.Pod) string {
+	waiting := []string{}
+	for _, status := range getContainerStatuses(pod) {
+		switch reason := getContainerReason(status); reason {
+		case "ContainerCreating", "PodInitializing":
+			waiting = append(waiting, fmt.Sprintf("%s: %s", status.Name, reason))
+		}
+	}
+	return strings.Join(waiting, ", ")
+}
+
+// getContainerReason returns the reason the container is waiting, or the reason it terminated unsuccessfully.
+func getContainerReason(status corev1.ContainerStatus) string {
+	if status.State.Waiting != nil {
+		return status.State.Waiting.Reason
+	}
+	if status.State.Terminated != nil && status.State.Terminated.ExitCode != 0 {
+		return status.State.Terminated.Reason
+	}
+	return ""
+}
+
+// describeContainerProblem returns e.g. app: CrashLoopBackOff (exited with 1: Error, 5 restarts).
+func describeContainerProblem(status corev1.ContainerStatus) string {
+	details := []string{}
+	terminated := status.State.Terminated
+	if terminated == nil {
+		terminated = status.LastTerminationState.Terminated
+	}
+	if terminated != nil && terminated.ExitCode != 0 {
+		details = append(details, fmt.Sprintf("exited with %d: %s", terminated.ExitCode, terminated.Reason))
+	}
+	if status.RestartCount == 1 {
+		details = append(details, "1 restart")
+	} else if status.RestartCount > 1 {
+		details = append(details, fmt.Sprintf("%d restarts", status.RestartCount))
+	}
+
+	reason := getContainerReason(status)
+	if reason == "" {
+		reason = "Running"
+	}
+	if len(details) == 0 {
+		return fmt.Sprintf("%s: %s", status.Name, reason)
+	}
+	return fmt.Sprintf("%s: %s (%s)", status.Name, reason, strings.Join(details, ", "))
+}
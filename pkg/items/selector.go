@@ -0,0 +1,168 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package items
+
+import (
+	"fmt"
+
+	"github.com/erayan/k8s-wait-for-multi/pkg/conditions"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+type NamespacedSelectorCollection map[string]SelectorCollection
+
+// SelectorCollection is keyed by the selector string as returned by SelectorItem.GetName.
+type SelectorCollection map[string]*SelectorItem
+
+// SelectorItem tracks all pods in its namespace that match a label selector.
+type SelectorItem struct {
+	namespace string
+	selector  labels.Selector
+	condition conditions.Condition
+	children  PodCollection
+	synced    bool
+	threshold Threshold
+	rules     FailureRules
+}
+
+func Selector(ns string, selector labels.Selector) *SelectorItem {
+	return &SelectorItem{
+		namespace: ns,
+		selector:  selector,
+		children:  PodCollection{},
+		synced:    false,
+	}
+}
+
+// WithCondition sets the condition that is used for all matching pods.
+func (i *SelectorItem) WithCondition(condition conditions.Condition) *SelectorItem {
+	i.condition = condition
+	return i
+}
+
+// WithSynced marks that all pods that existed at the start have been seen.
+func (i *SelectorItem) WithSynced(synced bool) *SelectorItem {
+	i.synced = synced
+	return i
+}
+
+// Matches returns true when the pod is in the namespace of the item and its labels match the selector.
+func (i *SelectorItem) Matches(pod *corev1.Pod) bool {
+	return pod.Namespace == i.namespace && i.selector.Matches(labels.Set(pod.Labels))
+}
+
+// WithPod adds or updates the pod as a child when it matches the selector, and removes it otherwise.
+func (i *SelectorItem) WithPod(pod *corev1.Pod) *SelectorItem {
+	if !i.Matches(pod) {
+		delete(i.children, pod.Name)
+		return i
+	}
+	if _, ok := i.children[pod.Name]; !ok {
+		i.children[pod.Name] = Pod(pod.Namespace, pod.Name).WithCondition(i.condition).WithFailureRules(i.rules)
+	}
+	i.children[pod.Name].WithReadyFromPod(pod)
+	return i
+}
+
+func (i *SelectorItem) GetChildren() *PodCollection {
+	return &i.children
+}
+
+func (i *SelectorItem) WaitsForDeletion() bool {
+	return conditions.IsDelete(i.condition)
+}
+
+// WithFailureRules sets when the matching pods fail because they will never become ready.
+func (i *SelectorItem) WithFailureRules(rules FailureRules) *SelectorItem {
+	i.rules = rules
+	return i
+}
+
+// GetFailureRules returns when the matching pods fail because they will never become ready.
+func (i *SelectorItem) GetFailureRules() FailureRules {
+	return i.rules
+}
+
+// WithThreshold sets how many matching pods need to be ready for the selector to be available.
+func (i *SelectorItem) WithThreshold(threshold Threshold) *SelectorItem {
+	i.threshold = threshold
+	return i
+}
+
+// GetThreshold returns how many matching pods need to be ready for the selector to be available.
+func (i *SelectorItem) GetThreshold() Threshold {
+	return i.threshold
+}
+
+// IsAvailable returns true when enough matching pods are ready (see WithThreshold), or when waiting for deletion, when none are left.
+func (i *SelectorItem) IsAvailable() bool {
+	if i.WaitsForDeletion() {
+		return i.synced && len(i.children) == 0
+	}
+	return i.children.IsThresholdMet(i.threshold)
+}
+
+// GetName returns the selector in brackets, e.g. [app=web].
+func (i *SelectorItem) GetName() string {
+	return fmt.Sprintf("[%s]", i.selector.String())
+}
+
+func (i *SelectorItem) GetNamespace() string {
+	return i.namespace
+}
+
+func (c SelectorItem) DeletePod(i ItemInterface) {
+	if c.namespace == i.GetNamespace() {
+		delete(c.children, i.GetName())
+	}
+}
+
+func (c NamespacedSelectorCollection) DeletePod(i ItemInterface) {
+	for _, selector := range c[i.GetNamespace()] {
+		selector.DeletePod(i)
+	}
+}
+
+func (c NamespacedSelectorCollection) EnsureNamespace(ns string) {
+	if _, ok := c[ns]; !ok {
+		c[ns] = SelectorCollection{}
+	}
+}
+
+func (c NamespacedSelectorCollection) ContainsNamespacedName(ns string, n string) bool {
+	_, ok := c[ns][n]
+	return ok
+}
+
+func (c NamespacedSelectorCollection) ContainsPod(i ItemInterface) bool {
+	for _, selector := range c[i.GetNamespace()] {
+		if selector.children.Contains(i) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c NamespacedSelectorCollection) TotalCount() int {
+	count := 0
+	for _, items := range c {
+		count += len(items)
+	}
+	return count
+}
@@ -16,15 +16,34 @@
 
 package items
 
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/erayan/k8s-wait-for-multi/pkg/conditions"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
 type NamespacedServiceCollection map[string]ServiceCollection
 
 type ServiceCollection map[string]*ServiceItem
 
 type ServiceItem struct {
+	itemStatus
+
 	namespace  string
 	name       string
 	children   PodCollection
 	isExternal bool
+	threshold  Threshold
+	rules      FailureRules
+
+	// podSelector is the selector of the service, it is used to find the workloads that manage its pods.
+	podSelector map[string]string
+	// workloadFailures holds why the workloads that manage the pods of the service can not roll out anymore, keyed by KIND/NAME.
+	workloadFailures map[string]string
 }
 
 func Service(ns string, n string) *ServiceItem {
@@ -45,6 +64,84 @@ func (i *ServiceItem) WithChildren(children PodCollection) *ServiceItem {
 	return i
 }
 
+// WithFailureRules sets when the pods of the service fail because they will never become ready.
+func (i *ServiceItem) WithFailureRules(rules FailureRules) *ServiceItem {
+	i.rules = rules
+	return i
+}
+
+// GetFailureRules returns when the pods of the service fail because they will never become ready.
+func (i *ServiceItem) GetFailureRules() FailureRules {
+	return i.rules
+}
+
+// WithThreshold sets how many pods need to be ready for the service to be available.
+func (i *ServiceItem) WithThreshold(threshold Threshold) *ServiceItem {
+	i.threshold = threshold
+	return i
+}
+
+// GetThreshold returns how many pods need to be ready for the service to be available.
+func (i *ServiceItem) GetThreshold() Threshold {
+	return i.threshold
+}
+
+func (i *ServiceItem) WithCondition(condition conditions.Condition) *ServiceItem {
+	i.condition = condition
+	return i
+}
+
+// WithConditionFromService evaluates the custom condition against the service, a nil service marks it as not existing.
+func (i *ServiceItem) WithConditionFromService(svc *corev1.Service) *ServiceItem {
+	if svc == nil {
+		i.absent()
+	} else {
+		i.observe(svc)
+	}
+	return i
+}
+
+// WithPodSelector sets the selector of the service.
+func (i *ServiceItem) WithPodSelector(selector map[string]string) *ServiceItem {
+	i.podSelector = selector
+	return i
+}
+
+// GetPodSelector returns the selector of the service.
+func (i *ServiceItem) GetPodSelector() map[string]string {
+	return i.podSelector
+}
+
+// WithWorkloadFailure sets why the workload (e.g. deployment/api) that manages the pods of the service can not roll out anymore,
+// the empty string clears it.
+func (i *ServiceItem) WithWorkloadFailure(workload string, failure string) *ServiceItem {
+	if failure == "" {
+		delete(i.workloadFailures, workload)
+		return i
+	}
+	if i.workloadFailures == nil {
+		i.workloadFailures = map[string]string{}
+	}
+	i.workloadFailures[workload] = failure
+	return i
+}
+
+// WithoutWorkloadFailures clears why the workloads that manage the pods of the service can not roll out anymore.
+func (i *ServiceItem) WithoutWorkloadFailures() *ServiceItem {
+	i.workloadFailures = nil
+	return i
+}
+
+// GetWorkloadFailure returns why the first workload (by name) that manages the pods of the service can not roll out anymore,
+// e.g. deployment/api: ProgressDeadlineExceeded, or the empty string.
+func (i *ServiceItem) GetWorkloadFailure() string {
+	workloads := slices.Sorted(maps.Keys(i.workloadFailures))
+	if len(workloads) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s: %s", workloads[0], i.workloadFailures[workloads[0]])
+}
+
 func (i *ServiceItem) WithExternal(isExternal bool) *ServiceItem {
 	i.isExternal = isExternal
 	if i.isExternal {
@@ -57,38 +154,17 @@ func (i *ServiceItem) IsExternal() bool {
 	return i.isExternal
 }
 
+// IsAvailable returns true when enough pods of the service are ready, see WithThreshold.
 func (i *ServiceItem) IsAvailable() bool {
-	if i.isExternal {
-		return true
-	}
-
-	if len(i.children) == 0 {
-		return false
+	if i.condition != nil {
+		return i.met
 	}
 
-	for _, item := range i.children {
-		if !item.ready {
-			return false
-		}
-	}
-	return true
-}
-
-func (i *ServiceItem) IsAtLeastOneAvailable() bool {
 	if i.isExternal {
 		return true
 	}
 
-	if len(i.children) == 0 {
-		return false
-	}
-
-	for _, item := range i.children {
-		if item.ready {
-			return true
-		}
-	}
-	return false
+	return i.children.IsThresholdMet(i.threshold)
 }
 
 func (i *ServiceItem) GetName() string {
@@ -176,20 +252,3 @@ func (c NamespacedServiceCollection) TotalCount() int {
 	}
 	return count
 }
-
-func (c NamespacedServiceCollection) AreAllAvailable(onlyOnePerServiceRequired bool) bool {
-	for _, services := range c {
-		for _, service := range services {
-			if onlyOnePerServiceRequired {
-				if !service.IsAtLeastOneAvailable() {
-					return false
-				}
-			} else {
-				if !service.IsAvailable() {
-					return false
-				}
-			}
-		}
-	}
-	return true
-}
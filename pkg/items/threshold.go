@@ -0,0 +1,74 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package items
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Threshold is how many pods of a service, owner or selector need to be ready, either an absolute number
+// or a percentage of all its pods. The zero value requires all pods to be ready.
+type Threshold struct {
+	min *intstr.IntOrString
+}
+
+// MinOne requires at least one ready pod, it is what --only-one-per-service-required sets for every item.
+var MinOne = Threshold{min: &intstr.IntOrString{Type: intstr.Int, IntVal: 1}}
+
+// ParseThreshold parses a positive number (e.g. 2) or a percentage (e.g. 75%).
+func ParseThreshold(value string) (Threshold, error) {
+	min := intstr.Parse(value)
+	if min.Type == intstr.String {
+		if !strings.HasSuffix(value, "%") {
+			return Threshold{}, fmt.Errorf("expected a number or a percentage, got '%s'", value)
+		}
+		percent := intstr.Parse(strings.TrimSuffix(value, "%"))
+		if percent.Type != intstr.Int || percent.IntVal <= 0 || percent.IntVal > 100 {
+			return Threshold{}, fmt.Errorf("percentage must be between 1%% and 100%%, got '%s'", value)
+		}
+	} else if min.IntVal <= 0 {
+		return Threshold{}, fmt.Errorf("minimum must be positive, got '%s'", value)
+	}
+	return Threshold{min: &min}, nil
+}
+
+// IsAll returns true when all pods need to be ready.
+func (t Threshold) IsAll() bool {
+	return t.min == nil
+}
+
+// Required returns how many of the given number of pods need to be ready, percentages are rounded up.
+// At least one pod is always required, so an empty service is never available.
+func (t Threshold) Required(total int) int {
+	required := total
+	if t.min != nil {
+		// the value is validated when it is parsed
+		required, _ = intstr.GetScaledValueFromIntOrPercent(t.min, total, true)
+	}
+	return max(required, 1)
+}
+
+// String returns the threshold as it is given in the ;min= option, or all.
+func (t Threshold) String() string {
+	if t.min == nil {
+		return "all"
+	}
+	return t.min.String()
+}
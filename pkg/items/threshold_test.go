@@ -0,0 +1,80 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package items
+
+import "testing"
+
+func TestThresholdRequired(t *testing.T) {
+	tests := []struct {
+		min   string
+		total int
+		want  int
+	}{
+		{min: "", total: 3, want: 3},
+		{min: "", total: 0, want: 1},
+		{min: "1", total: 3, want: 1},
+		{min: "2", total: 3, want: 2},
+		{min: "5", total: 3, want: 5},
+		{min: "2", total: 0, want: 2},
+		{min: "50%", total: 4, want: 2},
+		{min: "50%", total: 3, want: 2},
+		{min: "75%", total: 3, want: 3},
+		{min: "1%", total: 3, want: 1},
+		{min: "34%", total: 3, want: 2},
+		{min: "100%", total: 3, want: 3},
+		{min: "1%", total: 0, want: 1},
+		{min: "100%", total: 0, want: 1},
+	}
+	for _, tt := range tests {
+		threshold := Threshold{}
+		if tt.min != "" {
+			var err error
+			if threshold, err = ParseThreshold(tt.min); err != nil {
+				t.Fatalf("ParseThreshold(%q) failed: %v", tt.min, err)
+			}
+		}
+		if got := threshold.Required(tt.total); got != tt.want {
+			t.Errorf("Required(%d) with min %s = %d, want %d", tt.total, threshold, got, tt.want)
+		}
+	}
+}
+
+func TestParseThreshold(t *testing.T) {
+	tests := []struct {
+		value string
+		err   bool
+	}{
+		{value: "1"},
+		{value: "25%"},
+		{value: "100%"},
+		{value: "0", err: true},
+		{value: "-1", err: true},
+		{value: "0%", err: true},
+		{value: "101%", err: true},
+		{value: "1.5%", err: true},
+		{value: "half", err: true},
+	}
+	for _, tt := range tests {
+		threshold, err := ParseThreshold(tt.value)
+		if tt.err && err == nil {
+			t.Errorf("ParseThreshold(%q) = %s, expected an error", tt.value, threshold)
+		}
+		if !tt.err && (err != nil || threshold.String() != tt.value) {
+			t.Errorf("ParseThreshold(%q) = %s, %v", tt.value, threshold, err)
+		}
+	}
+}
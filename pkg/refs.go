@@ -0,0 +1,604 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package pkg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/erayan/k8s-wait-for-multi/pkg/items"
+
+	"github.com/xlab/treeprint"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	itemKindService  = "service"
+	itemKindPod      = "pod"
+	itemKindJob      = "job"
+	itemKindOwner    = "owner"
+	itemKindSelector = "selector"
+	itemKindResource = "resource"
+)
+
+// itemRef identifies a single item of a cluster, Name is the key of the item in the collection of its kind.
+type itemRef struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// itemState holds what is tracked for every item independent of its kind.
+type itemState struct {
+	// group is the name of the group the item is a member of, those items are only done through their group.
+	group string
+
+	timeout time.Duration
+	// missingTimeout is how long the object may not exist once the item is waited for, zero disables it.
+	missingTimeout time.Duration
+	optional       bool
+	// waitOnFailure keeps waiting for an item that failed instead of failing the wait, e.g. for jobs that are retried by hand.
+	waitOnFailure bool
+	// skipped is set when an optional item was not done before its timeout or failed, it is done from then on.
+	skipped    bool
+	skipReason string
+
+	// err is why the object of the item could not be processed, processing it is retried until it succeeds.
+	err string
+
+	// id is the name other items can use to depend on this item.
+	id string
+	// after holds the ids and groups that need to be done before this item is waited for.
+	after []string
+	// active is set once all dependencies are done, inactive items are never done.
+	active      bool
+	activatedAt time.Time
+
+	// stableFor is how long the item needs to be ready without interruption before it is done.
+	stableFor  time.Duration
+	readySince time.Time
+	stable     bool
+
+	// item is the handle of the item that is used in groups and dependencies.
+	item *clusterItem
+}
+
+func (c *Cluster) getState(ref itemRef) *itemState {
+	if _, ok := c.states[ref]; !ok {
+		c.states[ref] = &itemState{item: &clusterItem{cluster: c, ref: ref}}
+	}
+	return c.states[ref]
+}
+
+func (c *Cluster) isGrouped(ref itemRef) bool {
+	return c.getState(ref).group != ""
+}
+
+// itemRefs returns all items of the cluster, ordered by kind, namespace and name.
+func (c *Cluster) itemRefs() []itemRef {
+	refs := []itemRef{}
+	add := func(kind string, ns string, names []string) {
+		sort.Strings(names)
+		for _, n := range names {
+			refs = append(refs, itemRef{Kind: kind, Namespace: ns, Name: n})
+		}
+	}
+
+	for _, ns := range sortedKeys(c.Services) {
+		add(itemKindService, ns, sortedKeys(c.Services[ns]))
+	}
+	for _, ns := range sortedKeys(c.Pods) {
+		add(itemKindPod, ns, sortedKeys(c.Pods[ns]))
+	}
+	for _, ns := range sortedKeys(c.Jobs) {
+		add(itemKindJob, ns, sortedKeys(c.Jobs[ns]))
+	}
+	for _, ns := range sortedKeys(c.Owners) {
+		add(itemKindOwner, ns, sortedKeys(c.Owners[ns]))
+	}
+	for _, ns := range sortedKeys(c.Selectors) {
+		add(itemKindSelector, ns, sortedKeys(c.Selectors[ns]))
+	}
+	for _, ns := range sortedKeys(c.Resources) {
+		add(itemKindResource, ns, sortedKeys(c.Resources[ns]))
+	}
+
+	return refs
+}
+
+// isItemDone returns whether the item is done and stable, or skipped. Items that still wait for their dependencies are never done.
+func (c *Cluster) isItemDone(ref itemRef) bool {
+	state := c.getState(ref)
+	return state.active && (state.skipped || (c.isItemReady(ref) && (state.stableFor == 0 || state.stable)))
+}
+
+// updateStability tracks since when the items that need to be stable are ready, it returns true when any of them
+// became stable or stopped being stable.
+func (c *Cluster) updateStability(now time.Time) bool {
+	changed := false
+	for _, ref := range c.itemRefs() {
+		state := c.getState(ref)
+		if state.stableFor == 0 || !state.active {
+			continue
+		}
+		if !c.isItemReady(ref) {
+			changed = changed || state.stable
+			state.readySince = time.Time{}
+			state.stable = false
+			continue
+		}
+		if state.readySince.IsZero() {
+			state.readySince = now
+		}
+		if !state.stable && now.Sub(state.readySince) >= state.stableFor {
+			state.stable = true
+			changed = true
+		}
+	}
+	return changed
+}
+
+// resetStability makes the item count down again from the next time it is ready.
+func (c *Cluster) resetStability(ref itemRef) {
+	state := c.getState(ref)
+	state.readySince = time.Time{}
+	state.stable = false
+}
+
+// isCountingDown returns true when any item is ready but not stable yet.
+func (c *Cluster) isCountingDown() bool {
+	for _, ref := range c.itemRefs() {
+		state := c.getState(ref)
+		if state.active && state.stableFor > 0 && !state.stable && !state.readySince.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// isItemReady returns whether the item itself is done, services, owners and selectors honour their threshold.
+func (c *Cluster) isItemReady(ref itemRef) bool {
+	switch ref.Kind {
+	case itemKindService:
+		return c.Services[ref.Namespace][ref.Name].IsAvailable()
+	case itemKindPod:
+		return c.Pods[ref.Namespace][ref.Name].IsReady()
+	case itemKindJob:
+		return c.Jobs[ref.Namespace][ref.Name].IsComplete()
+	case itemKindOwner:
+		return c.Owners[ref.Namespace][ref.Name].IsAvailable()
+	case itemKindSelector:
+		return c.Selectors[ref.Namespace][ref.Name].IsAvailable()
+	case itemKindResource:
+		return c.Resources[ref.Namespace][ref.Name].IsReady()
+	}
+	return false
+}
+
+// getItemFailure returns why the item can not be done anymore, or the empty string.
+func (c *Cluster) getItemFailure(ref itemRef) string {
+	switch ref.Kind {
+	case itemKindService:
+		val := c.Services[ref.Namespace][ref.Name]
+		if val.HasCondition() || val.IsExternal() {
+			return val.GetFailure()
+		}
+		if failure := val.GetChildren().GetFailure(val.GetThreshold()); failure != "" {
+			return failure
+		}
+		return val.GetWorkloadFailure()
+	case itemKindPod:
+		return c.Pods[ref.Namespace][ref.Name].GetFailure()
+	case itemKindJob:
+		return c.Jobs[ref.Namespace][ref.Name].GetFailure()
+	case itemKindOwner:
+		val := c.Owners[ref.Namespace][ref.Name]
+		return val.GetChildren().GetFailure(val.GetThreshold())
+	case itemKindSelector:
+		val := c.Selectors[ref.Namespace][ref.Name]
+		return val.GetChildren().GetFailure(val.GetThreshold())
+	case itemKindResource:
+		return c.Resources[ref.Namespace][ref.Name].GetFailure()
+	}
+	return ""
+}
+
+// isItemObject returns whether the item waits for the object of the kind with the name in the namespace of the item.
+func (c *Cluster) isItemObject(ref itemRef, gvk schema.GroupVersionKind, name string) bool {
+	switch ref.Kind {
+	case itemKindService:
+		return gvk == ServiceGVK && ref.Name == name
+	case itemKindPod:
+		return gvk == PodGVK && c.Pods[ref.Namespace][ref.Name].GetName() == name
+	case itemKindJob:
+		return gvk == JobGVK && ref.Name == name
+	case itemKindResource:
+		return ref.Name == items.ResourceKey(gvk, name)
+	}
+	return false
+}
+
+// getMissingSince returns since when the object of the item is known to not exist, counted from when the item is waited for.
+// It is zero when the object exists, its existence is not known yet or the kind does not track it (owners and selectors).
+func (c *Cluster) getMissingSince(ref itemRef) time.Time {
+	var since time.Time
+	switch ref.Kind {
+	case itemKindService:
+		since = c.Services[ref.Namespace][ref.Name].GetMissingSince()
+	case itemKindPod:
+		since = c.Pods[ref.Namespace][ref.Name].GetMissingSince()
+	case itemKindJob:
+		since = c.Jobs[ref.Namespace][ref.Name].GetMissingSince()
+	case itemKindResource:
+		since = c.Resources[ref.Namespace][ref.Name].GetMissingSince()
+	}
+	if state := c.getState(ref); !since.IsZero() && since.Before(state.activatedAt) {
+		return state.activatedAt
+	}
+	return since
+}
+
+// getUnfinishedReason returns why the item is not done, e.g. Pending [after=db], Failed (BackoffLimitExceeded: ...)
+// or Unavailable (2/3 ready) (waiting for 5m0s).
+func (c *Cluster) getUnfinishedReason(ref itemRef, now time.Time) string {
+	state := c.getState(ref)
+	if !state.active {
+		return strings.TrimSpace(fmt.Sprintf("Pending %s", state.getDependencyLabel()))
+	}
+	if state.err != "" {
+		return fmt.Sprintf("Error (%s)", state.err)
+	}
+	if failure := c.getItemFailure(ref); failure != "" {
+		return fmt.Sprintf("Failed (%s)", failure)
+	}
+	if since := c.getMissingSince(ref); !since.IsZero() {
+		return fmt.Sprintf("NotFound for %s", now.Sub(since).Round(time.Second))
+	}
+	ready := c.isItemReady(ref)
+	if ready {
+		return fmt.Sprintf("NotStable%s", state.getStabilityLabel(ready, now))
+	}
+	return c.getItemStatus(ref, true) + state.getWaitingLabel(ready, now)
+}
+
+// getItemName returns the item in the form KIND/NAME.
+func (c *Cluster) getItemName(ref itemRef) string {
+	switch ref.Kind {
+	case itemKindSelector:
+		return fmt.Sprintf("pod/%s", ref.Name)
+	case itemKindResource:
+		return c.Resources[ref.Namespace][ref.Name].GetName()
+	}
+	return fmt.Sprintf("%s/%s", ref.Kind, ref.Name)
+}
+
+// getQualifiedItemName returns the item in the form CONTEXT:NAMESPACE/KIND/NAME, the context is left out for the current context
+// and the namespace for cluster-scoped resources.
+func (c *Cluster) getQualifiedItemName(ref itemRef) string {
+	name := c.getItemName(ref)
+	if ref.Namespace != "" {
+		name = fmt.Sprintf("%s/%s", ref.Namespace, name)
+	}
+	if c.name != "" {
+		name = fmt.Sprintf("%s:%s", c.name, name)
+	}
+	return name
+}
+
+// addItemNode adds the item to the tree, items with children (like services) are added as a branch.
+func (c *Cluster) addItemNode(tree treeprint.Tree, ref itemRef, name string) {
+	state := c.getState(ref)
+	if dependencies := state.getDependencyLabel(); dependencies != "" {
+		name = fmt.Sprintf("%s %s", name, dependencies)
+	}
+
+	if !state.active {
+		tree.AddMetaNode(TreeStatusNotDone, fmt.Sprintf("%s: Pending", name))
+		return
+	}
+
+	if state.skipped {
+		tree.AddMetaNode(TreeStatusIgnored, fmt.Sprintf("%s: Skipped (%s)", name, state.skipReason))
+		return
+	}
+
+	if state.err != "" {
+		tree.AddMetaNode(doneStatus(c.isItemDone(ref)), fmt.Sprintf("%s: Error (%s)", name, state.err))
+		return
+	}
+
+	ready := c.isItemReady(ref)
+	done := c.isItemDone(ref)
+	now := time.Now()
+	// ready items count down to be stable, the others show how long they are waited for
+	timing := state.getStabilityLabel(ready, now) + state.getWaitingLabel(ready, now)
+
+	// branches are computed from their children, unless the item is ready but not stable yet
+	branchMeta := treeprint.MetaValue(TreeStatusUnknown)
+	if ready && !done {
+		branchMeta = TreeStatusNotDone
+	}
+
+	label := fmt.Sprintf("%s: %s%s", name, c.getItemStatus(ref, true), timing)
+
+	switch ref.Kind {
+	case itemKindService:
+		val := c.Services[ref.Namespace][ref.Name]
+		if val.HasCondition() || val.IsMissing() {
+			tree.AddMetaNode(doneStatus(done), label)
+		} else if val.IsExternal() {
+			tree.AddMetaBranch(doneStatus(done), label)
+		} else {
+			c.addPodNodes(tree.AddMetaBranch(branchMeta, label), *val.GetChildren(), ready)
+		}
+	case itemKindPod:
+		val := c.Pods[ref.Namespace][ref.Name]
+		if val.GetContainer() != "" {
+			c.addContainerNodes(tree.AddMetaBranch(doneStatus(done), label), val)
+		} else {
+			tree.AddMetaNode(doneStatus(done), label)
+		}
+	case itemKindOwner:
+		c.addPodNodes(tree.AddMetaBranch(branchMeta, label), *c.Owners[ref.Namespace][ref.Name].GetChildren(), ready)
+	case itemKindSelector:
+		val := c.Selectors[ref.Namespace][ref.Name]
+		// a selector that waits for deletion is done without any children left
+		meta := branchMeta
+		if val.WaitsForDeletion() && ready {
+			meta = doneStatus(done)
+		}
+		c.addPodNodes(tree.AddMetaBranch(meta, label), *val.GetChildren(), ready)
+	default:
+		tree.AddMetaNode(doneStatus(done), label)
+	}
+}
+
+// addPodNodes adds the child pods of a service, owner or selector, pods that are not ready are ignored
+// when the parent is available because enough of the others are.
+func (c *Cluster) addPodNodes(branch treeprint.Tree, pods items.PodCollection, parentIsAvailable bool) {
+	for _, podname := range sortedKeys(pods) {
+		pod := pods[podname]
+		status := c.getPodStatus(pod, true)
+		meta := TreeStatusNotDone
+		if pod.IsReady() {
+			meta = TreeStatusDone
+		} else if parentIsAvailable {
+			status = "Ignored"
+			meta = TreeStatusIgnored
+		}
+		branch.AddMetaNode(meta, itemLabel(fmt.Sprintf("pod/%s", podname), status, pod))
+	}
+}
+
+// addContainerNodes adds all containers of a pod of which a single container is waited for, the other containers are ignored.
+func (c *Cluster) addContainerNodes(branch treeprint.Tree, pod *items.PodItem) {
+	for _, container := range pod.GetContainerStates() {
+		meta := treeprint.MetaValue(TreeStatusIgnored)
+		if container.Name == pod.GetContainer() {
+			meta = doneStatus(pod.IsReady())
+		}
+		branch.AddMetaNode(meta, fmt.Sprintf("container/%s: %s", container.Name, container.Status))
+	}
+}
+
+// getItemStatus returns the status of the item, e.g. Unavailable (2/3 ready) or NotComplete (1/3 succeeded, 2 active).
+// With decorate pods also show how long they are unschedulable and their latest warning, the status without them
+// only changes when the item does.
+func (c *Cluster) getItemStatus(ref itemRef, decorate bool) string {
+	ready := c.isItemReady(ref)
+	switch ref.Kind {
+	case itemKindService:
+		val := c.Services[ref.Namespace][ref.Name]
+		status := "Unavailable"
+		if val.IsExternal() && ready {
+			status = "External"
+		} else if ready {
+			status = "Available"
+		}
+		if !val.HasCondition() && !val.IsExternal() {
+			status += getReadyLabel(val.GetThreshold(), *val.GetChildren())
+			if failure := val.GetWorkloadFailure(); failure != "" && !ready {
+				status += fmt.Sprintf(" (%s)", failure)
+			}
+		}
+		return statusLabel(status, val)
+	case itemKindPod:
+		val := c.Pods[ref.Namespace][ref.Name]
+		if val.GetContainer() != "" {
+			return getContainerStatus(val)
+		}
+		return statusLabel(c.getPodStatus(val, decorate), val)
+	case itemKindJob:
+		val := c.Jobs[ref.Namespace][ref.Name]
+		if val.IsMissing() && val.IsComplete() {
+			return "NotFound (counted as complete)"
+		}
+		return statusLabel(getJobStatus(val), val)
+	case itemKindOwner:
+		val := c.Owners[ref.Namespace][ref.Name]
+		status := "Unavailable"
+		if ready {
+			status = "Available"
+		}
+		return status + getReadyLabel(val.GetThreshold(), *val.GetChildren())
+	case itemKindSelector:
+		val := c.Selectors[ref.Namespace][ref.Name]
+		if val.WaitsForDeletion() {
+			if ready {
+				return "Deleted"
+			}
+			return fmt.Sprintf("%d remaining", len(*val.GetChildren()))
+		}
+		status := "Unavailable"
+		if ready {
+			status = "Available"
+		}
+		return status + getReadyLabel(val.GetThreshold(), *val.GetChildren())
+	case itemKindResource:
+		val := c.Resources[ref.Namespace][ref.Name]
+		status := "NotReady"
+		if ready {
+			status = "Ready"
+		} else if failure := val.GetFailure(); failure != "" && !val.HasCondition() {
+			status = failure
+		}
+		return statusLabel(status, val)
+	}
+	return ""
+}
+
+// getPodStatus returns whether the pod is ready, and why not when that is known, e.g. NotReady (Running, 1/2 containers ready, app: CrashLoopBackOff).
+// With decorate it shows how long the pod is unschedulable and is followed by its latest warning,
+// e.g. NotReady (Unschedulable for 2m0s), last warning: FailedScheduling: 0/3 nodes are available: 3 Insufficient cpu.
+func (c *Cluster) getPodStatus(pod *items.PodItem, decorate bool) string {
+	if pod.IsReady() {
+		return "Ready"
+	}
+
+	warning, hasWarning := c.podWarnings[pod.GetUID()]
+	hasWarning = hasWarning && pod.GetUID() != "" && decorate
+
+	status := "NotReady"
+	if failure := pod.GetFailure(); failure != "" && !pod.ReplacesStatus() {
+		status = fmt.Sprintf("Failed (%s)", failure)
+	} else if since, message := pod.GetUnschedulable(); !since.IsZero() {
+		unschedulable := "Unschedulable"
+		if decorate {
+			unschedulable = fmt.Sprintf("Unschedulable for %s", time.Since(since).Round(time.Second))
+		}
+		// the warning of the scheduler repeats the message of the condition
+		if hasWarning || message == "" {
+			status = fmt.Sprintf("NotReady (%s)", unschedulable)
+		} else {
+			status = fmt.Sprintf("NotReady (%s: %s)", unschedulable, message)
+		}
+	} else if details := pod.GetDetails(); details != "" {
+		status = fmt.Sprintf("NotReady (%s)", details)
+	}
+
+	if hasWarning {
+		status = fmt.Sprintf("%s, last warning: %s", status, warning)
+	}
+	return status
+}
+
+// getJobStatus returns whether the job is complete, and its progress when it is not,
+// e.g. NotComplete (2/5 succeeded, 1 active, completed indexes: 0-1).
+func getJobStatus(job *items.JobItem) string {
+	if job.IsComplete() {
+		switch {
+		case job.HasIndexes():
+			return fmt.Sprintf("Complete (indexes %s completed)", job.GetIndexes())
+		case job.IsSuccessCriteriaMet():
+			return "Complete (SuccessCriteriaMet)"
+		}
+		return "Complete"
+	}
+	if job.IsOutdated() {
+		return "Outdated (created before the wait started)"
+	}
+	if failure := job.GetFailure(); failure != "" && !job.HasCondition() {
+		return failure
+	}
+	if progress := job.GetProgress(); progress != "" {
+		return fmt.Sprintf("NotComplete (%s)", progress)
+	}
+	return "NotComplete"
+}
+
+// getContainerStatus returns whether the container of the pod meets its condition, e.g. Started or NotStarted.
+func getContainerStatus(pod *items.PodItem) string {
+	if pod.IsMissing() {
+		return "NotFound"
+	}
+	if failure := pod.GetFailure(); failure != "" {
+		return fmt.Sprintf("Failed (%s)", failure)
+	}
+	status := map[items.ContainerCondition]string{
+		items.ContainerReady:     "Ready",
+		items.ContainerStarted:   "Started",
+		items.ContainerSucceeded: "Succeeded",
+	}[pod.GetContainerCondition()]
+	if !pod.IsReady() {
+		status = "Not" + status
+	}
+	return status
+}
+
+// getReadyLabel returns how many pods are ready, and how many need to be when not all of them do, e.g. " (2/3 ready, min=75%)".
+func getReadyLabel(threshold items.Threshold, pods items.PodCollection) string {
+	if len(pods) == 0 && threshold.IsAll() {
+		return " (no pods)"
+	}
+	if threshold.IsAll() {
+		return fmt.Sprintf(" (%d/%d ready)", pods.CountReady(), len(pods))
+	}
+	return fmt.Sprintf(" (%d/%d ready, min=%s)", pods.CountReady(), len(pods), threshold)
+}
+
+// getDependencyLabel returns the id and dependencies of the item in the form they are given as options, e.g. [id=migrate, after=db].
+func (s *itemState) getDependencyLabel() string {
+	options := []string{}
+	if s.id != "" {
+		options = append(options, fmt.Sprintf("id=%s", s.id))
+	}
+	if len(s.after) > 0 {
+		options = append(options, fmt.Sprintf("after=%s", strings.Join(s.after, ",")))
+	}
+	if len(options) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("[%s]", strings.Join(options, ", "))
+}
+
+// getStabilityLabel returns how long a ready item still needs to stay ready, e.g. " (stable in 25s)".
+func (s *itemState) getStabilityLabel(ready bool, now time.Time) string {
+	if s.stableFor == 0 || s.stable || !ready {
+		return ""
+	}
+	remaining := s.stableFor
+	if !s.readySince.IsZero() {
+		remaining -= now.Sub(s.readySince)
+	}
+	return fmt.Sprintf(" (stable in %s)", remaining.Round(time.Second))
+}
+
+// getWaitingLabel returns how long an item that is not ready is waited for, e.g. " (waiting for 1m20s)".
+func (s *itemState) getWaitingLabel(ready bool, now time.Time) string {
+	if ready || s.skipped || !s.active {
+		return ""
+	}
+	return fmt.Sprintf(" (waiting for %s)", now.Sub(s.activatedAt).Round(time.Second))
+}
+
+func doneStatus(done bool) treeprint.MetaValue {
+	if done {
+		return TreeStatusDone
+	}
+	return TreeStatusNotDone
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,387 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/erayan/k8s-wait-for-multi/pkg/items"
+)
+
+// OutputFormat selects what is written to stdout, the log output for people is written to stderr in every format.
+type OutputFormat string
+
+const (
+	// OutputText writes nothing to stdout.
+	OutputText OutputFormat = "text"
+	// OutputJSON writes a single Summary when the wait ends.
+	OutputJSON OutputFormat = "json"
+	// OutputNDJSON writes a StatusLine for every change of an item and a Summary when the wait ends, one JSON document per line.
+	OutputNDJSON OutputFormat = "ndjson"
+)
+
+var outputFormats = []OutputFormat{OutputText, OutputJSON, OutputNDJSON}
+
+// ParseOutputFormat parses one of text, json or ndjson.
+func ParseOutputFormat(value string) (OutputFormat, error) {
+	format := OutputFormat(value)
+	if !slices.Contains(outputFormats, format) {
+		return "", fmt.Errorf("expected one of %v, got '%s'", outputFormats, value)
+	}
+	return format, nil
+}
+
+// ReportVersion is the version of the json and ndjson output. It changes when fields are removed or change their meaning,
+// new fields and new values of Reason can be added without changing it.
+const ReportVersion = 1
+
+// The types of the documents in the json and ndjson output.
+const (
+	ReportTypeStatus  = "status"
+	ReportTypeSummary = "summary"
+)
+
+// The states of an item in the json and ndjson output.
+const (
+	// ItemStatePending is used while the dependencies of the item (;after=) are not done.
+	ItemStatePending = "Pending"
+	ItemStateNotDone = "NotDone"
+	ItemStateDone    = "Done"
+	// ItemStateFailed is used for items that can not be done anymore, which fails the wait unless the item is optional or waits on failure.
+	ItemStateFailed = "Failed"
+	// ItemStateError is used while the object of the item can not be processed, it is retried.
+	ItemStateError = "Error"
+	// ItemStateSkipped is used for optional items that failed or were not done before their timeout.
+	ItemStateSkipped = "Skipped"
+)
+
+// The states of the children of an item in the json and ndjson output.
+const (
+	ChildStateDone    = "Done"
+	ChildStateNotDone = "NotDone"
+	// ChildStateIgnored is used for children that are not needed, e.g. pods that are not ready once enough others are.
+	ChildStateIgnored = "Ignored"
+)
+
+// The outcomes of the wait in the Summary.
+const (
+	OutcomeDone    = "done"
+	OutcomeTimeout = "timeout"
+	OutcomeFailed  = "failed"
+	OutcomeError   = "error"
+)
+
+// ItemReport is the state of an item. Kind is one of service, pod, job, owner, selector or resource and Name is the name
+// as it is given in the argument, e.g. web-0/app for a container, app=web for a selector or deployment/web for a resource.
+// Reason describes the state for people, it does not contain durations so it only changes when the item does.
+type ItemReport struct {
+	Context   string        `json:"context,omitempty"`
+	Namespace string        `json:"namespace,omitempty"`
+	Kind      string        `json:"kind"`
+	Name      string        `json:"name"`
+	Item      string        `json:"item"`
+	Group     string        `json:"group,omitempty"`
+	State     string        `json:"state"`
+	Reason    string        `json:"reason,omitempty"`
+	Children  []ChildReport `json:"children,omitempty"`
+}
+
+// ChildReport is the state of a pod of a service, owner or selector, or of a container of a pod.
+type ChildReport struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	State  string `json:"state"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// StatusLine is written in the ndjson output every time the state, reason or children of an item change.
+type StatusLine struct {
+	Type    string    `json:"type"`
+	Version int       `json:"version"`
+	Time    time.Time `json:"time"`
+	ItemReport
+}
+
+// ItemSummary is the final state of an item. StartedAt is when the item was waited for, which is later than the start of the wait
+// for items with dependencies, and is left out for items that were still pending. DoneAt is when the item was done last.
+// DurationSeconds is how long the item took to be done, or how long it was waited for when it is not done.
+type ItemSummary struct {
+	ItemReport
+	StartedAt       *time.Time `json:"startedAt,omitempty"`
+	DoneAt          *time.Time `json:"doneAt,omitempty"`
+	DurationSeconds *float64   `json:"durationSeconds,omitempty"`
+}
+
+// GroupSummary is the final state of a group.
+type GroupSummary struct {
+	Name    string `json:"name"`
+	Mode    string `json:"mode"`
+	Group   string `json:"group,omitempty"`
+	State   string `json:"state"`
+	Done    int    `json:"done"`
+	Members int    `json:"members"`
+}
+
+// Summary is written when the wait ends, as the last line of the ndjson output or as the only document of the json output.
+// Error is the reason the wait was not done, it is left out when the outcome is done.
+type Summary struct {
+	Type            string         `json:"type"`
+	Version         int            `json:"version"`
+	Time            time.Time      `json:"time"`
+	Outcome         string         `json:"outcome"`
+	ExitCode        int            `json:"exitCode"`
+	Error           string         `json:"error,omitempty"`
+	StartedAt       time.Time      `json:"startedAt"`
+	DurationSeconds float64        `json:"durationSeconds"`
+	Items           []ItemSummary  `json:"items"`
+	Groups          []GroupSummary `json:"groups"`
+}
+
+// reportedItem is what was last reported about an item.
+type reportedItem struct {
+	report ItemReport
+	doneAt time.Time
+}
+
+// WithOutput writes the json or ndjson output to out, the text output does not write anything.
+func (w *Waitables) WithOutput(format OutputFormat, out io.Writer) *Waitables {
+	w.output = format
+	w.outputWriter = out
+	return w
+}
+
+// reportChanges writes a StatusLine for every item that changed since the last call in the ndjson output,
+// and tracks when items were done for the Summary.
+func (w *Waitables) reportChanges(now time.Time) {
+	if w.output == OutputText {
+		return
+	}
+	for _, cluster := range w.GetClusters() {
+		for _, ref := range cluster.itemRefs() {
+			report := cluster.getItemReport(ref)
+			reported, ok := w.reported[report.Item]
+			if ok && reflect.DeepEqual(reported.report, report) {
+				continue
+			}
+			if !ok {
+				reported = &reportedItem{}
+				w.reported[report.Item] = reported
+			}
+			if report.State != ItemStateDone {
+				reported.doneAt = time.Time{}
+			} else if reported.doneAt.IsZero() {
+				reported.doneAt = now
+			}
+			reported.report = report
+
+			if w.output == OutputNDJSON {
+				w.writeOutput(StatusLine{Type: ReportTypeStatus, Version: ReportVersion, Time: now.UTC(), ItemReport: report})
+			}
+		}
+	}
+}
+
+// PrintSummary writes the Summary of the wait in the json and ndjson output, err is the reason the wait was not done.
+func (w *Waitables) PrintSummary(err error, exitCode int) {
+	if w.output == OutputText {
+		return
+	}
+	now := time.Now()
+	w.reportChanges(now)
+
+	summary := Summary{
+		Type:            ReportTypeSummary,
+		Version:         ReportVersion,
+		Time:            now.UTC(),
+		Outcome:         getOutcome(err),
+		ExitCode:        exitCode,
+		StartedAt:       w.startedAt.UTC(),
+		DurationSeconds: toSeconds(now.Sub(w.startedAt)),
+		Items:           []ItemSummary{},
+		Groups:          []GroupSummary{},
+	}
+	if err != nil {
+		summary.Error = err.Error()
+	}
+
+	for _, cluster := range w.GetClusters() {
+		for _, ref := range cluster.itemRefs() {
+			state := cluster.getState(ref)
+			reported := w.reported[cluster.getQualifiedItemName(ref)]
+			item := ItemSummary{ItemReport: reported.report}
+			if state.active {
+				startedAt := state.activatedAt.UTC()
+				end := now
+				if !reported.doneAt.IsZero() {
+					doneAt := reported.doneAt.UTC()
+					item.DoneAt = &doneAt
+					end = reported.doneAt
+				}
+				duration := toSeconds(end.Sub(state.activatedAt))
+				item.StartedAt = &startedAt
+				item.DurationSeconds = &duration
+			}
+			summary.Items = append(summary.Items, item)
+		}
+	}
+
+	for _, g := range w.getGroups() {
+		state := ItemStateNotDone
+		if g.isDone() {
+			state = ItemStateDone
+		}
+		summary.Groups = append(summary.Groups, GroupSummary{
+			Name:    g.Name,
+			Mode:    g.getMode(),
+			Group:   g.Parent,
+			State:   state,
+			Done:    g.getDoneCount(),
+			Members: len(g.members),
+		})
+	}
+
+	w.writeOutput(summary)
+}
+
+// writeOutput writes a document, indented in the json output and on a single line in the ndjson output.
+func (w *Waitables) writeOutput(document any) {
+	encoder := json.NewEncoder(w.outputWriter)
+	if w.output == OutputJSON {
+		encoder.SetIndent("", "  ")
+	}
+	if err := encoder.Encode(document); err != nil {
+		log.Printf("Unable to write the %s output: %s", w.output, err.Error())
+	}
+}
+
+func getOutcome(err error) string {
+	var timedOut *TimeoutError
+	var failed *ItemFailedError
+	switch {
+	case err == nil:
+		return OutcomeDone
+	case errors.As(err, &timedOut):
+		return OutcomeTimeout
+	case errors.As(err, &failed):
+		return OutcomeFailed
+	}
+	return OutcomeError
+}
+
+// toSeconds returns the duration in seconds, rounded to milliseconds.
+func toSeconds(d time.Duration) float64 {
+	return math.Round(d.Seconds()*1000) / 1000
+}
+
+// getItemReport returns the state of the item, see ItemReport.
+func (c *Cluster) getItemReport(ref itemRef) ItemReport {
+	state := c.getState(ref)
+	report := ItemReport{
+		Context:   c.name,
+		Namespace: ref.Namespace,
+		Kind:      ref.Kind,
+		Name:      ref.Name,
+		Item:      c.getQualifiedItemName(ref),
+		Group:     state.group,
+		Children:  c.getChildReports(ref),
+	}
+	if ref.Kind == itemKindResource {
+		report.Name = c.Resources[ref.Namespace][ref.Name].GetName()
+	}
+	failure := c.getItemFailure(ref)
+	switch {
+	case !state.active:
+		report.State = ItemStatePending
+		report.Reason = fmt.Sprintf("after=%s", strings.Join(state.after, ","))
+	case state.skipped:
+		report.State = ItemStateSkipped
+		report.Reason = state.skipReason
+	case state.err != "":
+		report.State = ItemStateError
+		report.Reason = state.err
+	case c.isItemDone(ref):
+		report.State = ItemStateDone
+		report.Reason = c.getItemStatus(ref, false)
+	case failure != "":
+		report.State = ItemStateFailed
+		report.Reason = failure
+	default:
+		report.State = ItemStateNotDone
+		report.Reason = c.getItemStatus(ref, false)
+		if c.isItemReady(ref) {
+			report.Reason += " (not stable yet)"
+		}
+	}
+	return report
+}
+
+// getChildReports returns the pods of services, owners and selectors, and the containers of pods of which a single container is waited for.
+func (c *Cluster) getChildReports(ref itemRef) []ChildReport {
+	var pods items.PodCollection
+	switch ref.Kind {
+	case itemKindService:
+		val := c.Services[ref.Namespace][ref.Name]
+		if val.HasCondition() || val.IsExternal() {
+			return nil
+		}
+		pods = *val.GetChildren()
+	case itemKindOwner:
+		pods = *c.Owners[ref.Namespace][ref.Name].GetChildren()
+	case itemKindSelector:
+		pods = *c.Selectors[ref.Namespace][ref.Name].GetChildren()
+	case itemKindPod:
+		val := c.Pods[ref.Namespace][ref.Name]
+		children := []ChildReport{}
+		for _, container := range val.GetContainerStates() {
+			state := ChildStateIgnored
+			if container.Name == val.GetContainer() {
+				state = ChildStateNotDone
+				if val.IsReady() {
+					state = ChildStateDone
+				}
+			}
+			children = append(children, ChildReport{Kind: "container", Name: container.Name, State: state, Reason: container.Status})
+		}
+		return children
+	default:
+		return nil
+	}
+
+	ready := c.isItemReady(ref)
+	children := []ChildReport{}
+	for _, name := range sortedKeys(pods) {
+		pod := pods[name]
+		child := ChildReport{Kind: itemKindPod, Name: name, State: ChildStateDone, Reason: statusLabel(c.getPodStatus(pod, false), pod)}
+		if !pod.IsReady() {
+			child.State = ChildStateNotDone
+			if ready {
+				child.State = ChildStateIgnored
+			}
+		}
+		children = append(children, child)
+	}
+	return children
+}
@@ -0,0 +1,169 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// decodeLines decodes every line of the ndjson output into a map.
+func decodeLines(t *testing.T, out *bytes.Buffer) []map[string]any {
+	t.Helper()
+	documents := []map[string]any{}
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		document := map[string]any{}
+		if err := json.Unmarshal([]byte(line), &document); err != nil {
+			t.Fatalf("line %q is not a json document: %v", line, err)
+		}
+		documents = append(documents, document)
+	}
+	out.Reset()
+	return documents
+}
+
+func TestReportNDJSON(t *testing.T) {
+	w, err := linkWaitables(t, []string{"release=all"}, []string{"job,migrate;id=migrate;group=release", "pod,web;after=migrate"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	w.WithOutput(OutputNDJSON, out)
+
+	w.reportChanges(time.Now())
+	lines := decodeLines(t, out)
+	if len(lines) != 2 {
+		t.Fatalf("expected a status line for every item, got %v", lines)
+	}
+	states := map[string]map[string]any{}
+	for _, line := range lines {
+		if line["type"] != ReportTypeStatus || line["version"] != float64(ReportVersion) {
+			t.Errorf("unexpected type or version in %v", line)
+		}
+		if _, ok := line["time"]; !ok {
+			t.Errorf("missing time in %v", line)
+		}
+		states[line["item"].(string)] = line
+	}
+	if web := states["default/pod/web"]; web["state"] != ItemStatePending || web["reason"] != "after=migrate" || web["kind"] != "pod" || web["namespace"] != "default" {
+		t.Errorf("unexpected status of the pod: %v", web)
+	}
+	if migrate := states["default/job/migrate"]; migrate["state"] != ItemStateNotDone || migrate["group"] != "release" {
+		t.Errorf("unexpected status of the job: %v", migrate)
+	}
+
+	w.reportChanges(time.Now())
+	if lines := decodeLines(t, out); len(lines) != 0 {
+		t.Errorf("expected no status lines without changes, got %v", lines)
+	}
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "migrate", UID: "run-1"},
+		Status: batchv1.JobStatus{
+			Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}},
+		},
+	}
+	if _, err := w.GetClusters()[0].ProcessEventAddJob(context.Background(), job); err != nil {
+		t.Fatal(err)
+	}
+	w.reportChanges(time.Now())
+	lines = decodeLines(t, out)
+	if len(lines) != 1 || lines[0]["item"] != "default/job/migrate" || lines[0]["state"] != ItemStateDone {
+		t.Fatalf("expected a status line for the completed job, got %v", lines)
+	}
+
+	w.PrintSummary(&TimeoutError{Timeout: time.Minute}, 2)
+	summaryLines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(summaryLines) != 1 {
+		t.Fatalf("expected the summary on a single line, got %q", out.String())
+	}
+	summary := Summary{}
+	if err := json.Unmarshal([]byte(summaryLines[0]), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Type != ReportTypeSummary || summary.Outcome != OutcomeTimeout || summary.ExitCode != 2 || summary.Error == "" {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+	items := map[string]ItemSummary{}
+	for _, item := range summary.Items {
+		items[item.Item] = item
+	}
+	if migrate := items["default/job/migrate"]; migrate.State != ItemStateDone || migrate.StartedAt == nil || migrate.DoneAt == nil || migrate.DurationSeconds == nil {
+		t.Errorf("unexpected summary of the job: %+v", migrate)
+	}
+	if web := items["default/pod/web"]; web.State != ItemStatePending || web.StartedAt != nil || web.DoneAt != nil {
+		t.Errorf("unexpected summary of the pod: %+v", web)
+	}
+	if len(summary.Groups) != 1 || summary.Groups[0] != (GroupSummary{Name: "release", Mode: "all", State: ItemStateDone, Done: 1, Members: 1}) {
+		t.Errorf("unexpected groups: %+v", summary.Groups)
+	}
+}
+
+func TestReportJSON(t *testing.T) {
+	w, err := linkWaitables(t, nil, []string{"pod,web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	w.WithOutput(OutputJSON, out)
+
+	w.reportChanges(time.Now())
+	if out.Len() != 0 {
+		t.Fatalf("expected no status lines in the json output, got %q", out.String())
+	}
+
+	w.PrintSummary(nil, 0)
+	summary := map[string]any{}
+	if err := json.Unmarshal(out.Bytes(), &summary); err != nil {
+		t.Fatalf("the output is not a single json document: %v", err)
+	}
+	if !strings.Contains(out.String(), "\n  \"outcome\": \"done\"") {
+		t.Errorf("expected the summary to be indented, got %q", out.String())
+	}
+	if _, ok := summary["error"]; ok {
+		t.Errorf("expected no error when the outcome is done, got %v", summary["error"])
+	}
+	if groups, ok := summary["groups"].([]any); !ok || len(groups) != 0 {
+		t.Errorf("expected an empty list of groups, got %v", summary["groups"])
+	}
+}
+
+func TestReportText(t *testing.T) {
+	w, err := linkWaitables(t, nil, []string{"pod,web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	w.WithOutput(OutputText, out)
+
+	w.reportChanges(time.Now())
+	w.PrintSummary(nil, 0)
+	if out.Len() != 0 {
+		t.Errorf("expected no output in the text format, got %q", out.String())
+	}
+}
@@ -0,0 +1,535 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package pkg
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erayan/k8s-wait-for-multi/pkg/conditions"
+	"github.com/erayan/k8s-wait-for-multi/pkg/items"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// ClusterScope is used in place of the namespace to refer to cluster-scoped resources.
+	ClusterScope = ":cluster"
+	// SucceededSuffix after the name of a pod waits for the pod to reach phase Succeeded instead of being Ready.
+	SucceededSuffix = ":succeeded"
+	// ContextPrefix starts the optional kubeconfig context of an argument, e.g. ctx=east:NAMESPACE,KIND,NAME.
+	ContextPrefix = "ctx="
+)
+
+// RESTMapperFunc returns the RESTMapper for a kubeconfig context, the empty string is the current context.
+type RESTMapperFunc func(context string) (meta.RESTMapper, error)
+
+// Target is a single parsed argument that describes an item to wait for.
+type Target struct {
+	// Context is the kubeconfig context, the empty string is the current context.
+	Context   string
+	Namespace string
+	Kind      string
+	Name      string
+
+	// Container is set when a single container of a pod is waited for, e.g. mypod/istio-proxy:started.
+	Container          string
+	ContainerCondition items.ContainerCondition
+
+	// FailureRules decide when pods of the item fail because they will never become ready.
+	FailureRules items.FailureRules
+
+	// Min is how many pods of a service, owner or selector need to be ready, the zero value requires all of them.
+	Min items.Threshold
+
+	// Selector is set instead of a single name when the name is a label selector in brackets, e.g. [app=web].
+	Selector labels.Selector
+
+	// GroupVersionKind is only set for kinds other than pod, service, job and owner.
+	GroupVersionKind schema.GroupVersionKind
+	ClusterScoped    bool
+
+	// Condition replaces the default readiness check of the kind when set.
+	Condition conditions.Condition
+
+	// Group is the name of the group the item is a member of, items without a group all need to be done.
+	Group string
+
+	// Timeout is how long the item may take to be done, zero means only the global timeout applies.
+	Timeout time.Duration
+	// MissingTimeout is how long the object may not exist before the item fails, zero means it may not exist until the timeout.
+	MissingTimeout time.Duration
+	// Optional items are skipped instead of failing the wait when they are not done before their timeout.
+	Optional bool
+	// WaitOnFailure keeps waiting for the item when it failed, instead of failing the wait (or skipping it when optional).
+	WaitOnFailure bool
+
+	// RequireNew makes jobs that were created before the wait started outdated, they are not complete until they are created again.
+	RequireNew bool
+	// JobMissing decides what it means when a job does not exist.
+	JobMissing items.JobMissingPolicy
+	// Indexes makes an Indexed Job done once these indexes completed, instead of once the whole job is Complete.
+	Indexes items.IndexSet
+
+	// StableFor is how long the item needs to be done without interruption, zero means it is done right away.
+	StableFor time.Duration
+
+	// ID is the name other items can use in After to depend on this item.
+	ID string
+	// After holds the ids and groups that need to be done before the item is waited for.
+	After []string
+}
+
+// ParseTarget parses an argument in one of the forms NAMESPACE,KIND,NAME or KIND,NAME or KIND/NAME or NAME,
+// where the name of pods can also be a label selector in brackets, e.g. [app=web,tier!=db],
+// or a single container of the pod as NAME/CONTAINER[:ready|started|succeeded],
+// optionally prefixed with a kubeconfig context as ctx=CONTEXT: and followed by options as ;KEY=VALUE.
+// The namespace ClusterScope can be used for cluster-scoped kinds, those are also detected by the mapper when they are not explicitly marked.
+// The namespace and options that are not given in the argument are taken from the defaults.
+func ParseTarget(arg string, defaults Target, mappers RESTMapperFunc) (*Target, error) {
+	t := &defaults
+	clusterScopeRequested := false
+
+	// defaults (e.g. from --only-one-per-service-required) are only used by the kinds that support them,
+	// but options that are given explicitly need to be supported
+	explicit := map[string]bool{}
+	options := splitTopLevel(arg, ';')
+	for _, option := range options[1:] {
+		if err := t.parseOption(option); err != nil {
+			return nil, err
+		}
+		key, _, _ := strings.Cut(option, "=")
+		explicit[key] = true
+	}
+
+	if t.Optional && t.Timeout == 0 && t.MissingTimeout == 0 {
+		return nil, fmt.Errorf("optional items need a timeout or missing-timeout, e.g. ;optional;timeout=30s")
+	}
+
+	context, arg, err := splitContext(options[0])
+	if err != nil {
+		return nil, err
+	}
+	t.Context = context
+
+	arg_items := splitTopLevel(arg, ',')
+	switch len(arg_items) {
+	case 1:
+		if kind, name, found := strings.Cut(arg_items[0], "/"); found {
+			t.Kind = kind
+			t.Name = name
+		} else {
+			t.Kind = "pod"
+			t.Name = arg_items[0]
+		}
+	case 2:
+		t.Kind = arg_items[0]
+		t.Name = arg_items[1]
+	case 3:
+		if arg_items[0] == ClusterScope {
+			clusterScopeRequested = true
+		} else {
+			t.Namespace = arg_items[0]
+		}
+		t.Kind = arg_items[1]
+		t.Name = arg_items[2]
+	default:
+		return nil, fmt.Errorf("expected at most 3 comma separated values, got %d", len(arg_items))
+	}
+
+	if t.Kind == "" || t.Name == "" {
+		return nil, fmt.Errorf("kind and name can not be empty")
+	}
+
+	switch t.Kind {
+	case "pod", "service", "job", "owner":
+	default:
+		if err := t.resolveKind(mappers); err != nil {
+			return nil, err
+		}
+	}
+
+	if t.Kind == "pod" && !strings.HasPrefix(t.Name, "[") {
+		if name, container, found := strings.Cut(t.Name, "/"); found {
+			if explicit["for"] {
+				return nil, fmt.Errorf("conditions are not supported for containers, use %s/%s:%s instead", name, container, strings.Join(containerConditionNames(), "|"))
+			}
+			if err := t.parseContainer(name, container); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if t.Kind == "pod" && t.Container == "" && strings.HasSuffix(t.Name, SucceededSuffix) {
+		t.Name = strings.TrimSuffix(t.Name, SucceededSuffix)
+		t.Condition = conditions.Complete
+	}
+
+	if strings.HasPrefix(t.Name, "[") && strings.HasSuffix(t.Name, "]") {
+		if t.Kind != "pod" {
+			return nil, fmt.Errorf("label selectors are only supported for kind 'pod'")
+		}
+		selector, err := labels.Parse(strings.TrimSuffix(strings.TrimPrefix(t.Name, "["), "]"))
+		if err != nil {
+			return nil, fmt.Errorf("illegal label selector: %w", err)
+		}
+		if selector.Empty() {
+			return nil, fmt.Errorf("label selector can not be empty")
+		}
+		t.Selector = selector
+	}
+
+	if explicit["min"] && t.Kind != "service" && t.Kind != "owner" && t.Selector == nil {
+		return nil, fmt.Errorf("min is only supported for services, owners and label selectors")
+	}
+	if (explicit["fatal-reasons"] || explicit["restart-limit"] || explicit["unschedulable-timeout"]) && t.Kind != "pod" && t.Kind != "service" && t.Kind != "owner" {
+		return nil, fmt.Errorf("fatal-reasons, restart-limit and unschedulable-timeout are only supported for pods, services and owners")
+	}
+	if (explicit["require-new"] || explicit["job-missing"] || explicit["indexes"]) && t.Kind != "job" {
+		return nil, fmt.Errorf("require-new, job-missing and indexes are only supported for jobs")
+	}
+	if explicit["indexes"] && explicit["for"] {
+		return nil, fmt.Errorf("indexes can not be combined with a condition")
+	} else if explicit["indexes"] {
+		t.Condition = nil
+	}
+	if explicit["missing-timeout"] && (t.Kind == "owner" || t.Selector != nil) {
+		return nil, fmt.Errorf("missing-timeout is not supported for owners and label selectors")
+	}
+
+	switch t.Kind {
+	case "pod", "service", "job", "owner":
+		if t.Kind == "owner" && explicit["for"] {
+			return nil, fmt.Errorf("conditions are not supported for kind '%s'", t.Kind)
+		} else if t.Kind == "owner" {
+			t.Condition = nil
+		}
+		if t.Kind == "service" && t.Condition == conditions.Complete {
+			return nil, fmt.Errorf("complete is only supported for pods and jobs, not for kind '%s'", t.Kind)
+		}
+		if clusterScopeRequested {
+			return nil, fmt.Errorf("kind '%s' is not cluster-scoped", t.Kind)
+		}
+		return t, nil
+	}
+
+	if t.Condition == conditions.Complete {
+		return nil, fmt.Errorf("complete is only supported for pods and jobs, not for kind '%s'", t.Kind)
+	}
+
+	if t.ClusterScoped {
+		t.Namespace = ""
+	} else if clusterScopeRequested {
+		return nil, fmt.Errorf("kind '%s' is not cluster-scoped", t.Kind)
+	}
+
+	return t, nil
+}
+
+// resolveKind looks up a kind other than pod, service, job and owner through the mapper of the context.
+// Pods, services and jobs that are given another way (e.g. pods or jobs.batch) become those kinds, all other kinds
+// keep their group so that they can not be mistaken for them, e.g. service.serving.knative.dev.
+// It returns an APIError when the kinds of the context can not be looked up.
+func (t *Target) resolveKind(mappers RESTMapperFunc) error {
+	if mappers == nil {
+		return fmt.Errorf("unsupported kind '%s'", t.Kind)
+	}
+
+	mapper, err := mappers(t.Context)
+	if err != nil {
+		return &APIError{Err: err}
+	}
+
+	mapping, err := getRESTMapping(mapper, t.Kind)
+	if meta.IsNoMatchError(err) || meta.IsAmbiguousError(err) {
+		return fmt.Errorf("unsupported kind '%s': %w", t.Kind, err)
+	}
+	if err != nil {
+		// the kinds of the cluster could not be discovered, e.g. because it is not reachable
+		return &APIError{Err: err}
+	}
+
+	switch mapping.GroupVersionKind {
+	case PodGVK:
+		t.Kind = "pod"
+	case ServiceGVK:
+		t.Kind = "service"
+	case JobGVK:
+		t.Kind = "job"
+	default:
+		t.GroupVersionKind = mapping.GroupVersionKind
+		t.Kind = strings.ToLower(mapping.GroupVersionKind.GroupKind().String())
+		t.ClusterScoped = mapping.Scope.Name() == meta.RESTScopeNameRoot
+	}
+	return nil
+}
+
+// parseContainer parses the container of a pod in the form CONTAINER or CONTAINER:CONDITION, e.g. istio-proxy:started.
+// The condition from the defaults is replaced by the condition of the container.
+func (t *Target) parseContainer(name string, container string) error {
+	t.Condition = nil
+	t.Name = name
+	t.Container = container
+	t.ContainerCondition = items.ContainerReady
+	if container, condition, found := strings.Cut(container, ":"); found {
+		t.Container = container
+		t.ContainerCondition = items.ContainerCondition(condition)
+		if !slices.Contains(items.ContainerConditions, t.ContainerCondition) {
+			return fmt.Errorf("unknown container condition '%s', expected one of %s", condition, strings.Join(containerConditionNames(), ", "))
+		}
+	}
+	if t.Name == "" || t.Container == "" {
+		return fmt.Errorf("pod and container name can not be empty")
+	}
+	return nil
+}
+
+func containerConditionNames() []string {
+	names := []string{}
+	for _, condition := range items.ContainerConditions {
+		names = append(names, string(condition))
+	}
+	return names
+}
+
+// parseOption parses a single KEY=VALUE option that follows the target.
+func (t *Target) parseOption(option string) error {
+	key, value, hasValue := strings.Cut(option, "=")
+	switch key {
+	case "for":
+		condition, err := conditions.Parse(value)
+		if err != nil {
+			return err
+		}
+		t.Condition = condition
+	case "group":
+		if value == "" {
+			return fmt.Errorf("group option needs a group name")
+		}
+		t.Group = value
+	case "id":
+		if value == "" {
+			return fmt.Errorf("id option needs a name")
+		}
+		t.ID = value
+	case "after":
+		for _, name := range strings.Split(value, ",") {
+			if name == "" {
+				return fmt.Errorf("after option needs a comma separated list of ids or groups")
+			}
+			t.After = append(t.After, name)
+		}
+	case "timeout":
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("illegal timeout: %w", err)
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("timeout must be positive")
+		}
+		t.Timeout = timeout
+	case "missing-timeout":
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("illegal missing-timeout: %w", err)
+		}
+		if timeout < 0 {
+			return fmt.Errorf("missing-timeout can not be negative")
+		}
+		t.MissingTimeout = timeout
+	case "min":
+		min, err := items.ParseThreshold(value)
+		if err != nil {
+			return fmt.Errorf("illegal min: %w", err)
+		}
+		t.Min = min
+	case "fatal-reasons":
+		t.FailureRules.FatalReasons = nil
+		for _, reason := range strings.Split(value, ",") {
+			if reason != "" {
+				t.FailureRules.FatalReasons = append(t.FailureRules.FatalReasons, reason)
+			}
+		}
+	case "restart-limit":
+		limit, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("illegal restart-limit: %w", err)
+		}
+		if limit < 0 {
+			return fmt.Errorf("restart-limit can not be negative")
+		}
+		t.FailureRules.RestartLimit = int32(limit)
+	case "unschedulable-timeout":
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("illegal unschedulable-timeout: %w", err)
+		}
+		if timeout < 0 {
+			return fmt.Errorf("unschedulable-timeout can not be negative")
+		}
+		t.FailureRules.UnschedulableTimeout = timeout
+	case "stable-for":
+		stableFor, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("illegal stable-for: %w", err)
+		}
+		if stableFor < 0 {
+			return fmt.Errorf("stable-for can not be negative")
+		}
+		t.StableFor = stableFor
+	case "require-new":
+		if !hasValue {
+			t.RequireNew = true
+			return nil
+		}
+		requireNew, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("illegal value for require-new: %w", err)
+		}
+		t.RequireNew = requireNew
+	case "job-missing":
+		policy, err := items.ParseJobMissingPolicy(value)
+		if err != nil {
+			return fmt.Errorf("illegal job-missing: %w", err)
+		}
+		t.JobMissing = policy
+	case "indexes":
+		indexes, err := items.ParseIndexSet(value)
+		if err != nil {
+			return fmt.Errorf("illegal indexes: %w", err)
+		}
+		if len(indexes) == 0 {
+			return fmt.Errorf("indexes can not be empty")
+		}
+		t.Indexes = indexes
+	case "fail-fast":
+		failFast, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("illegal value for fail-fast: %w", err)
+		}
+		t.WaitOnFailure = !failFast
+	case "optional":
+		if !hasValue {
+			t.Optional = true
+			return nil
+		}
+		optional, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("illegal value for optional: %w", err)
+		}
+		t.Optional = optional
+	default:
+		return fmt.Errorf("unknown option '%s'", key)
+	}
+	return nil
+}
+
+// splitTopLevel splits the argument on the separator, separators within quotes or brackets
+// (e.g. in a jsonpath expression or a label selector) are ignored.
+func splitTopLevel(arg string, sep rune) []string {
+	parts := []string{}
+	start := 0
+	depth := 0
+	var quote rune
+
+	for i, r := range arg {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '{' || r == '[' || r == '(':
+			depth++
+		case r == '}' || r == ']' || r == ')':
+			if depth > 0 {
+				depth--
+			}
+		case r == sep && depth == 0:
+			parts = append(parts, arg[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, arg[start:])
+}
+
+// splitContext splits the kubeconfig context from the rest of the argument.
+// Context names can contain colons themselves (e.g. EKS cluster ARNs), so the last colon before the target is used.
+// The name of the KIND/NAME form can contain colons as well (e.g. clusterrole/system:node), the kind can not,
+// so for that form the context ends at the last colon before the kind.
+func splitContext(arg string) (string, string, error) {
+	if !strings.HasPrefix(arg, ContextPrefix) {
+		return "", arg, nil
+	}
+
+	rest := strings.TrimPrefix(arg, ContextPrefix)
+	head := rest
+	if end := strings.IndexAny(rest, ",;"); end >= 0 {
+		head = rest[:end]
+	}
+	head = strings.TrimSuffix(head, ClusterScope)
+	for _, condition := range items.ContainerConditions {
+		// the container conditions include succeeded, which is also the suffix of pods in completion mode
+		head = strings.TrimSuffix(head, ":"+string(condition))
+	}
+
+	sep := strings.LastIndex(head, ":")
+	if slash := strings.LastIndex(head, "/"); slash >= 0 {
+		sep = strings.LastIndex(head[:slash], ":")
+	}
+	if sep <= 0 {
+		return "", "", fmt.Errorf("expected the context to be followed by ':' in '%s'", arg)
+	}
+
+	return rest[:sep], rest[sep+1:], nil
+}
+
+// getRESTMapping resolves a resource (e.g. deployments.apps or crd) or kind (e.g. Deployment.apps) the same way kubectl does.
+func getRESTMapping(mapper meta.RESTMapper, resourceOrKind string) (*meta.RESTMapping, error) {
+	fullySpecifiedGVR, groupResource := schema.ParseResourceArg(strings.ToLower(resourceOrKind))
+	gvk := schema.GroupVersionKind{}
+	if fullySpecifiedGVR != nil {
+		gvk, _ = mapper.KindFor(*fullySpecifiedGVR)
+	}
+	if gvk.Empty() {
+		gvk, _ = mapper.KindFor(groupResource.WithVersion(""))
+	}
+	if !gvk.Empty() {
+		return mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+
+	fullySpecifiedGVK, groupKind := schema.ParseKindArg(resourceOrKind)
+	if fullySpecifiedGVK == nil {
+		gvk := groupKind.WithVersion("")
+		fullySpecifiedGVK = &gvk
+	}
+
+	if !fullySpecifiedGVK.Empty() {
+		if mapping, err := mapper.RESTMapping(fullySpecifiedGVK.GroupKind(), fullySpecifiedGVK.Version); err == nil {
+			return mapping, nil
+		}
+	}
+
+	return mapper.RESTMapping(groupKind)
+}
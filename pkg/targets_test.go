@@ -0,0 +1,155 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package pkg
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/erayan/k8s-wait-for-multi/pkg/conditions"
+	"github.com/erayan/k8s-wait-for-multi/pkg/items"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func testRESTMapper(context string) (meta.RESTMapper, error) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(PodGVK, meta.RESTScopeNamespace)
+	mapper.Add(JobGVK, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "serving.knative.dev", Version: "v1", Kind: "Service"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}, meta.RESTScopeRoot)
+	return mapper, nil
+}
+
+func TestParseTarget(t *testing.T) {
+	defaults := Target{Namespace: "default"}
+	withFor := Target{Namespace: "default", Condition: conditions.Complete}
+
+	tests := []struct {
+		arg      string
+		defaults Target
+		want     Target
+		err      bool
+	}{
+		// names and kinds
+		{arg: "web", want: Target{Namespace: "default", Kind: "pod", Name: "web"}},
+		{arg: "service,api", want: Target{Namespace: "default", Kind: "service", Name: "api"}},
+		{arg: "service/api", want: Target{Namespace: "default", Kind: "service", Name: "api"}},
+		{arg: "other,job,migrate", want: Target{Namespace: "other", Kind: "job", Name: "migrate"}},
+		{arg: "default,owner,api", want: Target{Namespace: "default", Kind: "owner", Name: "api"}},
+		{arg: "deployment,api", want: Target{Namespace: "default", Kind: "deployment.apps", Name: "api"}},
+		{arg: "clusterrole/system:node", want: Target{Kind: "clusterrole.rbac.authorization.k8s.io", Name: "system:node", ClusterScoped: true}},
+		{arg: ":cluster,clusterrole,admin", want: Target{Kind: "clusterrole.rbac.authorization.k8s.io", Name: "admin", ClusterScoped: true}},
+		{arg: ":cluster,service,api", err: true},
+
+		// other names of pods and jobs are the built-in kinds, kinds of other groups keep their group
+		{arg: "pods,web/istio-proxy:started", want: Target{Namespace: "default", Kind: "pod", Name: "web", Container: "istio-proxy", ContainerCondition: items.ContainerStarted}},
+		{arg: "pods/migrate:succeeded", want: Target{Namespace: "default", Kind: "pod", Name: "migrate", Condition: conditions.Complete}},
+		{arg: "jobs.batch,migrate;require-new", want: Target{Namespace: "default", Kind: "job", Name: "migrate"}},
+		{arg: "services.serving.knative.dev/hello", want: Target{Namespace: "default", Kind: "service.serving.knative.dev", Name: "hello"}},
+		{arg: "services.serving.knative.dev,hello;min=1", err: true},
+		{arg: "deployment,[app=web]", err: true},
+		{arg: "a,b,c,d", err: true},
+		{arg: "service,", err: true},
+		{arg: "unknown,api", err: true},
+
+		// pods in completion mode, containers and label selectors
+		{arg: "migrate:succeeded", want: Target{Namespace: "default", Kind: "pod", Name: "migrate", Condition: conditions.Complete}},
+		{arg: "pod,web/istio-proxy", want: Target{Namespace: "default", Kind: "pod", Name: "web", Container: "istio-proxy", ContainerCondition: items.ContainerReady}},
+		{arg: "pod,web/istio-proxy:started", want: Target{Namespace: "default", Kind: "pod", Name: "web", Container: "istio-proxy", ContainerCondition: items.ContainerStarted}},
+		{arg: "pod,web/istio-proxy:healthy", err: true},
+		{arg: "[app=web,tier!=db]", want: Target{Namespace: "default", Kind: "pod", Name: "[app=web,tier!=db]"}},
+		{arg: "service,[app=web]", err: true},
+		{arg: "[]", err: true},
+
+		// contexts
+		{arg: "ctx=east:web", want: Target{Context: "east", Namespace: "default", Kind: "pod", Name: "web"}},
+		{arg: "ctx=east:default,service,api", want: Target{Context: "east", Namespace: "default", Kind: "service", Name: "api"}},
+		{arg: "ctx=east:migrate:succeeded", want: Target{Context: "east", Namespace: "default", Kind: "pod", Name: "migrate", Condition: conditions.Complete}},
+		{arg: "ctx=east:clusterrole/system:node", want: Target{Context: "east", Kind: "clusterrole.rbac.authorization.k8s.io", Name: "system:node", ClusterScoped: true}},
+		{arg: "ctx=east::cluster,clusterrole,system:node", want: Target{Context: "east", Kind: "clusterrole.rbac.authorization.k8s.io", Name: "system:node", ClusterScoped: true}},
+		{arg: "ctx=arn:aws:eks:eu-west-1:123456789012:cluster/prod:service/api", want: Target{Context: "arn:aws:eks:eu-west-1:123456789012:cluster/prod", Namespace: "default", Kind: "service", Name: "api"}},
+		{arg: "ctx=arn:aws:eks:eu-west-1:123456789012:cluster/prod:clusterrole/system:node", want: Target{Context: "arn:aws:eks:eu-west-1:123456789012:cluster/prod", Kind: "clusterrole.rbac.authorization.k8s.io", Name: "system:node", ClusterScoped: true}},
+		{arg: "ctx=east", err: true},
+		{arg: "ctx=clusterrole/system:node", err: true},
+
+		// options
+		{arg: "job,migrate;timeout=30s;group=db", want: Target{Namespace: "default", Kind: "job", Name: "migrate", Timeout: 30 * time.Second, Group: "db"}},
+		{arg: "ctx=east:service/api;optional;timeout=1m", want: Target{Context: "east", Namespace: "default", Kind: "service", Name: "api", Timeout: time.Minute, Optional: true}},
+		{arg: "service,api;optional", err: true},
+		{arg: "service,api;timeout=-1s", err: true},
+		{arg: "job,migrate;min=2", err: true},
+		{arg: "service,api;require-new", err: true},
+		{arg: "service,api;unknown=1", err: true},
+
+		// conditions
+		{arg: "job,migrate;for=complete", want: Target{Namespace: "default", Kind: "job", Name: "migrate", Condition: conditions.Complete}},
+		{arg: "service,api;for=complete", err: true},
+		{arg: "deployment,api;for=complete", err: true},
+		{arg: "owner,api;for=delete", err: true},
+		{arg: "pod,web/istio-proxy;for=delete", err: true},
+		{arg: "job,migrate;indexes=0-2;for=complete", err: true},
+		{arg: "service,api", defaults: withFor, err: true},
+		{arg: "job,migrate", defaults: withFor, want: Target{Namespace: "default", Kind: "job", Name: "migrate", Condition: conditions.Complete}},
+		{arg: "owner,api", defaults: withFor, want: Target{Namespace: "default", Kind: "owner", Name: "api"}},
+		{arg: "pod,web/istio-proxy", defaults: withFor, want: Target{Namespace: "default", Kind: "pod", Name: "web", Container: "istio-proxy", ContainerCondition: items.ContainerReady}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.arg, func(t *testing.T) {
+			d := test.defaults
+			if d.Namespace == "" {
+				d = defaults
+			}
+			got, err := ParseTarget(test.arg, d, testRESTMapper)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			checks := []struct {
+				field     string
+				got, want interface{}
+			}{
+				{"context", got.Context, test.want.Context},
+				{"namespace", got.Namespace, test.want.Namespace},
+				{"kind", got.Kind, test.want.Kind},
+				{"name", got.Name, test.want.Name},
+				{"container", got.Container, test.want.Container},
+				{"container condition", got.ContainerCondition, test.want.ContainerCondition},
+				{"cluster scoped", got.ClusterScoped, test.want.ClusterScoped},
+				{"condition", fmt.Sprint(got.Condition), fmt.Sprint(test.want.Condition)},
+				{"group", got.Group, test.want.Group},
+				{"timeout", got.Timeout, test.want.Timeout},
+				{"optional", got.Optional, test.want.Optional},
+			}
+			for _, check := range checks {
+				if check.got != check.want {
+					t.Errorf("%s: got %v, want %v", check.field, check.got, check.want)
+				}
+			}
+		})
+	}
+}
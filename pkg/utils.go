@@ -16,7 +16,11 @@
 
 package pkg
 
-import "github.com/xlab/treeprint"
+import (
+	"fmt"
+
+	"github.com/xlab/treeprint"
+)
 
 const (
 	TreeStatusDone    = "✅"
@@ -27,6 +31,33 @@ const (
 
 type TreeStatus string
 
+type conditionItem interface {
+	HasCondition() bool
+	ReplacesStatus() bool
+	GetConditionStatus() string
+	IsMissing() bool
+}
+
+// itemLabel returns the label of an item in the tree, see statusLabel.
+func itemLabel(name string, status string, item conditionItem) string {
+	return fmt.Sprintf("%s: %s", name, statusLabel(status, item))
+}
+
+// statusLabel returns the status of an item, the status of a custom condition is appended when the item has one.
+// Conditions that describe the whole state of the item (like delete) replace the status, objects that do not exist are NotFound.
+func statusLabel(status string, item conditionItem) string {
+	if item.IsMissing() {
+		return "NotFound"
+	}
+	if item.ReplacesStatus() {
+		return item.GetConditionStatus()
+	}
+	if !item.HasCondition() {
+		return status
+	}
+	return fmt.Sprintf("%s (%s)", status, item.GetConditionStatus())
+}
+
 func metaInSlice(a treeprint.MetaValue, list []treeprint.MetaValue) bool {
 	for _, b := range list {
 		if b == a {
@@ -18,219 +18,437 @@ package pkg
 
 import (
 	"fmt"
+	"io"
 	"log"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/erayan/k8s-wait-for-multi/flags"
-	"github.com/erayan/k8s-wait-for-multi/pkg/items"
 
 	"github.com/xlab/treeprint"
-
-	batchv1 "k8s.io/api/batch/v1"
-	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/utils/strings/slices"
-	"sigs.k8s.io/controller-runtime/pkg/cache"
 )
 
+// ItemFailedError is returned when a required item failed, e.g. a job that reached its backoffLimit.
+type ItemFailedError struct {
+	// Item is the item in the form CONTEXT:NAMESPACE/KIND/NAME.
+	Item   string
+	Reason string
+}
+
+func (e *ItemFailedError) Error() string {
+	return fmt.Sprintf("%s failed: %s", e.Item, e.Reason)
+}
+
+// TimeoutError is returned when the wait, or a required item with its own timeout, is not done in time.
+type TimeoutError struct {
+	// Item is the item in the form CONTEXT:NAMESPACE/KIND/NAME, or the empty string when the whole wait timed out.
+	Item    string
+	Timeout time.Duration
+	// NotFound is set when the object of the item did not exist for longer than its missing timeout.
+	NotFound bool
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Item == "" {
+		return e.reason()
+	}
+	return fmt.Sprintf("%s is %s", e.Item, e.reason())
+}
+
+// reason describes the timeout without the item, e.g. not found after 1m0s.
+func (e *TimeoutError) reason() string {
+	if e.NotFound {
+		return fmt.Sprintf("not found after %s", e.Timeout)
+	}
+	return fmt.Sprintf("not done after %s", e.Timeout)
+}
+
+// APIError is returned when the Kubernetes API can not be used, e.g. because of missing permissions or an unknown kind.
+type APIError struct {
+	Err error
+}
+
+func (e *APIError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
 type Waitables struct {
-	cache.Cache
+	printTree          bool
+	printCollapsedTree bool
+	watchEvents        bool
+
+	// output is written to outputWriter, reported holds what was last reported about every item keyed by its qualified name.
+	output       OutputFormat
+	outputWriter io.Writer
+	reported     map[string]*reportedItem
+
+	startedAt time.Time
 
-	onlyOnePerServiceRequired bool
-	printTree                 bool
-	printCollapsedTree        bool
+	// lock guards the items, the ticker holds it while building the status, queuedPrints is guarded by it as well.
+	lock sync.Locker
 
 	ticker         *time.Ticker
 	queuedPrints   int
 	tickerDone     chan bool
 	tickerFinished chan bool
 
-	LastPodEvents map[types.UID]Event
+	// Clusters is keyed by the kubeconfig context name, the empty string is the current context.
+	Clusters map[string]*Cluster
 
-	Services items.NamespacedServiceCollection
-	Pods     items.NamespacedPodCollection
-	Jobs     items.NamespacedJobCollection
+	// Groups is keyed by the group name.
+	Groups map[string]*Group
+
+	// ids holds the items that other items can depend on, keyed by their id.
+	ids map[string]*clusterItem
+	// dependents holds the items that have dependencies.
+	dependents []*clusterItem
 }
 
-func (w *Waitables) AddItem(kind string, namespace string, name string) error {
-	switch kind {
-	case "pod":
-		w.addPod(namespace, name)
-	case "job":
-		w.addJob(namespace, name)
-	case "service":
-		w.addService(namespace, name)
-	default:
-		return fmt.Errorf("unsupported kind '%s'", kind)
+// AddGroup adds a group, groups need to be added before the targets that are part of them.
+func (w *Waitables) AddGroup(g *Group) error {
+	if _, ok := w.Groups[g.Name]; ok {
+		return fmt.Errorf("group '%s' is defined more than once", g.Name)
 	}
+	w.Groups[g.Name] = g
 	return nil
 }
 
-func (w *Waitables) addPod(namespace string, name string) *items.PodItem {
-	w.Pods.EnsureNamespace(namespace)
-	if !w.Pods.ContainsNamespacedName(namespace, name) {
-		w.Pods[namespace][name] = items.Pod(namespace, name)
+func (w *Waitables) AddTarget(t *Target) error {
+	cluster := w.EnsureCluster(t.Context)
+
+	ref, err := cluster.addTarget(t, w.startedAt)
+	if err != nil {
+		return err
+	}
+
+	state := cluster.getState(ref)
+	state.active = len(state.after) == 0
+	state.activatedAt = w.startedAt
+	if len(state.after) > 0 && !slices.Contains(w.dependents, state.item) {
+		w.dependents = append(w.dependents, state.item)
+	}
+
+	if t.ID != "" {
+		if _, ok := w.Groups[t.ID]; ok {
+			return fmt.Errorf("id '%s' is already used as a group name", t.ID)
+		}
+		if item, ok := w.ids[t.ID]; ok && item != state.item {
+			return fmt.Errorf("id '%s' is used more than once", t.ID)
+		}
+		state.id = t.ID
+		w.ids[t.ID] = state.item
+	}
+
+	if t.Group != "" {
+		g, ok := w.Groups[t.Group]
+		if !ok {
+			return fmt.Errorf("unknown group '%s'", t.Group)
+		}
+		if state.group == "" {
+			state.group = g.Name
+			g.addMember(state.item)
+		}
 	}
-	return w.Pods[namespace][name]
+	return nil
 }
 
-func (w *Waitables) addService(namespace string, name string) *items.ServiceItem {
-	w.Services.EnsureNamespace(namespace)
-	if !w.Services.ContainsNamespacedName(namespace, name) {
-		w.Services[namespace][name] = items.Service(namespace, name)
+// LinkGroups adds all groups to their parent groups, it fails on unknown parents, cycles and groups that can never be done.
+// It needs to be called after all targets are added.
+func (w *Waitables) LinkGroups() error {
+	for _, g := range w.getGroups() {
+		seen := map[string]bool{g.Name: true}
+		for parent := g.Parent; parent != ""; parent = w.Groups[parent].Parent {
+			if _, ok := w.Groups[parent]; !ok {
+				return fmt.Errorf("unknown group '%s' in group '%s'", parent, g.Name)
+			}
+			if seen[parent] {
+				return fmt.Errorf("group '%s' is (indirectly) a member of itself", parent)
+			}
+			seen[parent] = true
+		}
+	}
+
+	for _, g := range w.getGroups() {
+		if g.Parent != "" {
+			g.isMember = true
+			w.Groups[g.Parent].addMember(g)
+		}
+	}
+
+	for _, g := range w.getGroups() {
+		if len(g.members) == 0 {
+			return fmt.Errorf("group '%s' has no members", g.Name)
+		}
+		if g.getRequired() > len(g.members) {
+			return fmt.Errorf("group '%s' requires %d members but only has %d", g.Name, g.getRequired(), len(g.members))
+		}
 	}
-	return w.Services[namespace][name]
+	return nil
 }
 
-func (w *Waitables) addJob(namespace string, name string) *items.JobItem {
-	w.Jobs.EnsureNamespace(namespace)
-	if !w.Jobs.ContainsNamespacedName(namespace, name) {
-		w.Jobs[namespace][name] = items.Job(namespace, name)
+// getGroups returns all groups ordered by name.
+func (w *Waitables) getGroups() []*Group {
+	groups := []*Group{}
+	for _, name := range sortedKeys(w.Groups) {
+		groups = append(groups, w.Groups[name])
 	}
-	return w.Jobs[namespace][name]
+	return groups
 }
 
-func (w *Waitables) HasPodDirect(meta metav1.ObjectMeta) bool {
-	return w.Pods.Contains(&meta)
+// EnsureCluster returns the cluster for the kubeconfig context and creates it when it does not exist yet.
+func (w *Waitables) EnsureCluster(name string) *Cluster {
+	if _, ok := w.Clusters[name]; !ok {
+		w.Clusters[name] = newCluster(name, w.watchEvents)
+	}
+	return w.Clusters[name]
 }
 
-func (w *Waitables) HasPod(meta metav1.ObjectMeta) bool {
-	return w.HasPodDirect(meta) || w.Services.ContainsPod(&meta)
+// GetClusters returns all clusters ordered by their context name.
+func (w *Waitables) GetClusters() []*Cluster {
+	clusters := []*Cluster{}
+	for _, cluster := range w.Clusters {
+		clusters = append(clusters, cluster)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].name < clusters[j].name
+	})
+	return clusters
 }
 
-func (w *Waitables) HasService(meta metav1.ObjectMeta) bool {
-	return w.Services.Contains(&meta)
+// IsMultiCluster returns true when any item is waited for in a context other than the current one.
+func (w *Waitables) IsMultiCluster() bool {
+	for name := range w.Clusters {
+		if name != "" {
+			return true
+		}
+	}
+	return false
 }
 
-func (w *Waitables) HasJob(meta metav1.ObjectMeta) bool {
-	return w.Jobs.Contains(&meta)
+func (w *Waitables) IsDone() bool {
+	for _, cluster := range w.Clusters {
+		if !cluster.IsDone() {
+			return false
+		}
+	}
+	for _, g := range w.Groups {
+		if !g.isMember && !g.isDone() {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckTimeouts skips optional items and fails on required items that are not done after their own timeout,
+// or of which the object does not exist for longer than their missing timeout.
+// Items in a group that is done are not checked anymore. It returns true when any item was skipped.
+func (w *Waitables) CheckTimeouts(now time.Time) (bool, error) {
+	skipped := false
+	for _, cluster := range w.GetClusters() {
+		for _, ref := range cluster.itemRefs() {
+			state := cluster.getState(ref)
+			if state.skipped || !state.active {
+				continue
+			}
+			err := &TimeoutError{Item: cluster.getQualifiedItemName(ref), Timeout: state.timeout}
+			if state.timeout == 0 || now.Before(state.activatedAt.Add(state.timeout)) {
+				missingSince := cluster.getMissingSince(ref)
+				if state.missingTimeout == 0 || missingSince.IsZero() || now.Before(missingSince.Add(state.missingTimeout)) {
+					continue
+				}
+				err = &TimeoutError{Item: err.Item, Timeout: state.missingTimeout, NotFound: true}
+			}
+			if cluster.isItemDone(ref) || w.isGroupDone(state.group) {
+				continue
+			}
+			if !state.optional {
+				return skipped, err
+			}
+			log.Printf("Skipping optional %s, it is %s", err.Item, err.reason())
+			state.skipped = true
+			state.skipReason = err.reason()
+			skipped = true
+		}
+	}
+	return skipped, nil
 }
 
-func (w *Waitables) HasPods() bool {
-	return w.Pods.TotalCount() > 0
+// UpdateStability tracks since when the items that need to be stable are ready, it returns true when any of them
+// became stable or stopped being stable.
+func (w *Waitables) UpdateStability(now time.Time) bool {
+	changed := false
+	for _, cluster := range w.Clusters {
+		if cluster.updateStability(now) {
+			changed = true
+		}
+	}
+	return changed
 }
 
-func (w *Waitables) HasServices() bool {
-	return w.Services.TotalCount() > 0
+// IsCountingDown returns true when any item is ready but not stable yet.
+func (w *Waitables) IsCountingDown() bool {
+	for _, cluster := range w.Clusters {
+		if cluster.isCountingDown() {
+			return true
+		}
+	}
+	return false
 }
 
-func (w *Waitables) HasJobs() bool {
-	return w.Jobs.TotalCount() > 0
+// CheckFailures skips optional items and fails with an ItemFailedError on required items that can not be done anymore
+// (e.g. a pod in phase Failed or a job that reached its backoffLimit). Items in a group that is done and items that wait on failure
+// are not checked. It returns true when any item was skipped.
+func (w *Waitables) CheckFailures() (bool, error) {
+	skipped := false
+	for _, cluster := range w.GetClusters() {
+		for _, ref := range cluster.itemRefs() {
+			state := cluster.getState(ref)
+			if state.waitOnFailure || state.skipped || !state.active || cluster.isItemDone(ref) || w.isGroupDone(state.group) {
+				continue
+			}
+			failure := cluster.getItemFailure(ref)
+			if failure == "" {
+				continue
+			}
+			if !state.optional {
+				return skipped, &ItemFailedError{Item: cluster.getQualifiedItemName(ref), Reason: failure}
+			}
+			log.Printf("Skipping optional %s, it failed: %s", cluster.getQualifiedItemName(ref), failure)
+			state.skipped = true
+			state.skipReason = fmt.Sprintf("failed: %s", failure)
+			skipped = true
+		}
+	}
+	return skipped, nil
 }
 
-func (w *Waitables) IsDone() bool {
-	s := w.Services.AreAllAvailable(w.onlyOnePerServiceRequired)
-	p := w.Pods.AreAllReady()
-	j := w.Jobs.AreAllComplete()
-	return s && p && j
+// isGroupDone returns true when the group or any group it is (indirectly) a member of is done.
+func (w *Waitables) isGroupDone(name string) bool {
+	for ; name != ""; name = w.Groups[name].Parent {
+		if w.Groups[name].isDone() {
+			return true
+		}
+	}
+	return false
 }
 
+// PrintStatus queues printing the status, and reports the items that changed in the ndjson output right away.
 func (w *Waitables) PrintStatus() {
 	w.queuedPrints += 1
+	w.reportChanges(time.Now())
 }
 
-func (w *Waitables) internalPrintStatus() {
+// printQueuedStatus prints the status when printing it was queued, or always when forced.
+// The status is built while holding the lock, the event handlers change the items concurrently.
+func (w *Waitables) printQueuedStatus(force bool) {
+	w.lock.Lock()
+	if !force && w.queuedPrints == 0 {
+		w.lock.Unlock()
+		return
+	}
+	w.queuedPrints = 0
+	status := ""
 	if w.printTree {
-		log.Println(w.getStatusTreeString())
+		status = w.getStatusTreeString()
 	} else {
-		log.Println(w.getStatusString())
+		status = w.getStatusString()
 	}
+	w.lock.Unlock()
+
+	log.Println(status)
 }
 
 func (w *Waitables) getStatusString() string {
 	items := []string{}
-	for ns, nsitems := range w.Services {
-		for n, val := range nsitems {
-			if !val.IsAvailable() {
-				items = append(items, fmt.Sprintf("%s/service/%s", ns, n))
+	for _, cluster := range w.GetClusters() {
+		for _, item := range cluster.getStatusItems() {
+			if cluster.name != "" {
+				item = fmt.Sprintf("%s:%s", cluster.name, item)
 			}
+			items = append(items, item)
 		}
 	}
-	for ns, nsitems := range w.Pods {
-		for n, val := range nsitems {
-			if !val.IsReady() {
-				items = append(items, fmt.Sprintf("%s/pod/%s", ns, n))
-			}
+	for _, g := range w.getGroups() {
+		if !g.isMember && !g.isDone() {
+			items = append(items, g.getName())
 		}
 	}
-	for ns, nsitems := range w.Jobs {
-		for n, val := range nsitems {
-			if !val.IsComplete() {
-				items = append(items, fmt.Sprintf("%s/job/%s", ns, n))
+	return fmt.Sprintf("Waiting for: %s", strings.Join(items, ", "))
+}
+
+// unfinishedItem is an item that is not done when the wait ends.
+type unfinishedItem struct {
+	cluster *Cluster
+	ref     itemRef
+	// name is the item in the form CONTEXT:NAMESPACE/KIND/NAME.
+	name   string
+	reason string
+}
+
+// getUnfinished returns the items that are not done and why, items in a group that is done are left out.
+func (w *Waitables) getUnfinished(now time.Time) []unfinishedItem {
+	unfinished := []unfinishedItem{}
+	for _, cluster := range w.GetClusters() {
+		for _, ref := range cluster.itemRefs() {
+			state := cluster.getState(ref)
+			if cluster.isItemDone(ref) || w.isGroupDone(state.group) {
+				continue
 			}
+			unfinished = append(unfinished, unfinishedItem{
+				cluster: cluster,
+				ref:     ref,
+				name:    cluster.getQualifiedItemName(ref),
+				reason:  cluster.getUnfinishedReason(ref, now),
+			})
+		}
+	}
+	return unfinished
+}
+
+// PrintUnfinished prints the items and groups that are not done and why, it is used when the wait ends without being done.
+func (w *Waitables) PrintUnfinished() {
+	log.Println("Not done:")
+	for _, item := range w.getUnfinished(time.Now()) {
+		log.Printf("  %s: %s", item.name, item.reason)
+	}
+	for _, g := range w.getGroups() {
+		if !g.isMember && !g.isDone() {
+			log.Printf("  %s: %d/%d (%s)", g.getName(), g.getDoneCount(), len(g.members), g.getMode())
 		}
 	}
-	return fmt.Sprintf("Waiting for: %s", strings.Join(items, ", "))
 }
 
 func (w *Waitables) getStatusTreeString() string {
 
 	tree := treeprint.NewWithRoot("wait status")
 
-	namespace_branches := map[string]treeprint.Tree{}
-
-	for _, ns := range w.GetAllNamespaces() {
-		namespace_branches[ns] = tree.AddMetaBranch(TreeStatusUnknown, fmt.Sprintf("namespace/%s", ns))
-	}
-
-	for ns, nsitems := range w.Services {
-		branch := namespace_branches[ns]
-		for n, val := range nsitems {
-			status := "Unavailable"
-			svcIsAvailable := (!w.onlyOnePerServiceRequired && val.IsAvailable()) || (w.onlyOnePerServiceRequired && val.IsAtLeastOneAvailable())
-			if svcIsAvailable {
-				if val.IsExternal() {
-					status = "External"
-				} else {
-					status = "Available"
-				}
+	if w.IsMultiCluster() {
+		for _, cluster := range w.GetClusters() {
+			if !cluster.hasUngroupedItems() {
+				continue
 			}
-			var svc_branch treeprint.Tree
-
-			if val.IsExternal() {
-				svc_branch = branch.AddMetaBranch(TreeStatusDone, fmt.Sprintf("service/%s: %s", n, status))
-			} else {
-				svc_branch = branch.AddMetaBranch(TreeStatusUnknown, fmt.Sprintf("service/%s: %s", n, status))
-
-				for podname, pod := range *val.GetChildren() {
-					status := "NotReady"
-					meta := TreeStatusNotDone
-					if pod.IsReady() {
-						status = "Ready"
-						meta = TreeStatusDone
-					} else if w.onlyOnePerServiceRequired && svcIsAvailable {
-						status = "Ignored"
-						meta = TreeStatusIgnored
-					}
-					svc_branch.AddMetaNode(meta, fmt.Sprintf("pod/%s: %s", podname, status))
-				}
+			name := cluster.name
+			if name == "" {
+				name = "(current)"
 			}
+			cluster.addStatusTree(tree.AddMetaBranch(TreeStatusUnknown, fmt.Sprintf("context/%s", name)))
 		}
-	}
-	for ns, nsitems := range w.Pods {
-		branch := namespace_branches[ns]
-		for n, val := range nsitems {
-			status := "NotReady"
-			meta := TreeStatusNotDone
-			if val.IsReady() {
-				status = "Ready"
-				meta = TreeStatusDone
-			}
-			branch.AddMetaNode(meta, fmt.Sprintf("pod/%s: %s", n, status))
+	} else {
+		for _, cluster := range w.Clusters {
+			cluster.addStatusTree(tree)
 		}
 	}
-	for ns, nsitems := range w.Jobs {
-		branch := namespace_branches[ns]
-		for n, val := range nsitems {
-			status := "NotComplete"
-			meta := TreeStatusNotDone
-			if val.IsComplete() {
-				status = "Complete"
-				meta = TreeStatusDone
-			}
-			branch.AddMetaNode(meta, fmt.Sprintf("job/%s: %s", n, status))
+
+	for _, g := range w.getGroups() {
+		if !g.isMember {
+			g.addStatusNode(tree)
 		}
 	}
 
@@ -243,67 +461,12 @@ func (w *Waitables) getStatusTreeString() string {
 	return tree.String()
 }
 
-func (w *Waitables) SetPodReadyFromPod(pod *corev1.Pod) {
-	w.Pods[pod.Namespace][pod.Name].WithReadyFromPod(pod)
-}
-
-func (w *Waitables) SetPodReady(pod *corev1.Pod) {
-	w.Pods[pod.Namespace][pod.Name].WithReady(true)
-}
-
-func (w *Waitables) UnsetPodReady(pod *corev1.Pod) {
-	w.Pods[pod.Namespace][pod.Name].WithReady(false)
-}
-
-func (w *Waitables) SetJobCompleteFromJob(job *batchv1.Job) {
-	w.Jobs[job.Namespace][job.Name].WithCompleteFromJob(job)
-}
-
-func (w *Waitables) SetJobComplete(job *batchv1.Job) {
-	w.Jobs[job.Namespace][job.Name].WithComplete(true)
-}
-
-func (w *Waitables) UnsetJobComplete(job *batchv1.Job) {
-	w.Jobs[job.Namespace][job.Name].WithComplete(false)
-}
-
-func (w *Waitables) SetServiceChildren(meta *metav1.ObjectMeta, pods []corev1.Pod) {
-	podItems := items.PodCollection{}
-	for _, pod := range pods {
-		podItems[pod.Name] = items.Pod(pod.Namespace, pod.Name).WithReadyFromPod(&pod)
-	}
-	w.Services[meta.Namespace][meta.Name].WithChildren(podItems)
-}
-
-func (w *Waitables) SetServiceExternality(meta *metav1.ObjectMeta, isExternal bool) {
-	w.Services[meta.Namespace][meta.Name].WithExternal(isExternal)
-}
-
 func (w *Waitables) TotalCount() int {
-	return w.Services.TotalCount() + w.Pods.TotalCount() + w.Jobs.TotalCount()
-}
-
-func (w *Waitables) GetAllNamespaces() []string {
-	namespaces := []string{}
-
-	for ns := range w.Services {
-		if !slices.Contains(namespaces, ns) {
-			namespaces = append(namespaces, ns)
-		}
+	count := 0
+	for _, cluster := range w.Clusters {
+		count += cluster.TotalCount()
 	}
-
-	for ns := range w.Jobs {
-		if !slices.Contains(namespaces, ns) {
-			namespaces = append(namespaces, ns)
-		}
-	}
-	for ns := range w.Pods {
-		if !slices.Contains(namespaces, ns) {
-			namespaces = append(namespaces, ns)
-		}
-	}
-
-	return namespaces
+	return count
 }
 
 func (w *Waitables) Done() {
@@ -313,6 +476,7 @@ func (w *Waitables) Done() {
 }
 
 func (w *Waitables) Start() {
+	w.startedAt = time.Now()
 	go func() {
 		for {
 			if w.Ticker() {
@@ -326,37 +490,37 @@ func (w *Waitables) Start() {
 func (w *Waitables) Ticker() bool {
 	select {
 	case <-w.tickerDone:
-		w.internalPrintStatus()
+		w.printQueuedStatus(true)
 		return true
 	case <-w.ticker.C:
-		if w.queuedPrints > 0 {
-			w.queuedPrints = 0
-			w.internalPrintStatus()
-		}
+		w.printQueuedStatus(false)
 	}
 	return false
 }
 
-func (w *Waitables) WithCache(c cache.Cache) *Waitables {
-	w.Cache = c
+// WithLock sets the lock that guards the items, everything but Start and Done needs to be called with it held.
+func (w *Waitables) WithLock(lock sync.Locker) *Waitables {
+	w.lock = lock
 	return w
 }
 
 func NewWaitables(c *flags.ConfigFlags) *Waitables {
 	w := &Waitables{
-		LastPodEvents: map[types.UID]Event{},
-		Services:      items.NamespacedServiceCollection{},
-		Pods:          items.NamespacedPodCollection{},
-		Jobs:          items.NamespacedJobCollection{},
+		Clusters: map[string]*Cluster{},
+		Groups:   map[string]*Group{},
+		ids:      map[string]*clusterItem{},
+		reported: map[string]*reportedItem{},
+
+		output: OutputText,
 
 		ticker:         time.NewTicker(250 * time.Millisecond),
 		queuedPrints:   0,
 		tickerDone:     make(chan bool),
 		tickerFinished: make(chan bool),
 
-		printTree:                 *c.PrintTree,
-		printCollapsedTree:        *c.PrintCollapsedTree,
-		onlyOnePerServiceRequired: *c.OnlyOnePerServiceRequired,
+		printTree:          *c.PrintTree,
+		printCollapsedTree: *c.PrintCollapsedTree,
+		watchEvents:        *c.WatchEvents,
 	}
 
 	return w
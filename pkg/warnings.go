@@ -0,0 +1,75 @@
+/*
+ *  Copyright 2023 The k8s-wait-for-multi authors.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// podWarning is the latest warning Event of a pod, e.g. FailedScheduling.
+type podWarning struct {
+	reason  string
+	message string
+	at      time.Time
+}
+
+func (w podWarning) String() string {
+	return fmt.Sprintf("%s: %s", w.reason, w.message)
+}
+
+func (c *Cluster) ProcessEventAddWarning(ctx context.Context, event *corev1.Event) (bool, error) {
+	return c.setPodWarning(event), nil
+}
+
+func (c *Cluster) ProcessEventUpdateWarning(ctx context.Context, event *corev1.Event) (bool, error) {
+	return c.setPodWarning(event), nil
+}
+
+// setPodWarning keeps the event when it is the latest warning of a tracked pod, it returns true when it was kept.
+func (c *Cluster) setPodWarning(event *corev1.Event) bool {
+	if event.Type != corev1.EventTypeWarning || event.InvolvedObject.Kind != "Pod" {
+		return false
+	}
+	if !c.HasPod(metav1.ObjectMeta{Namespace: event.InvolvedObject.Namespace, Name: event.InvolvedObject.Name}) {
+		return false
+	}
+
+	at := getEventTime(event)
+	if latest, ok := c.podWarnings[event.InvolvedObject.UID]; ok && latest.at.After(at) {
+		return false
+	}
+	c.podWarnings[event.InvolvedObject.UID] = podWarning{reason: event.Reason, message: event.Message, at: at}
+	return true
+}
+
+// getEventTime returns when the event was last seen, events use different fields depending on the API that created them.
+func getEventTime(event *corev1.Event) time.Time {
+	switch {
+	case event.Series != nil && !event.Series.LastObservedTime.IsZero():
+		return event.Series.LastObservedTime.Time
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	}
+	return event.CreationTimestamp.Time
+}
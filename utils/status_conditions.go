@@ -17,8 +17,11 @@
 package utils
 
 import (
+	"fmt"
+
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 // Adapted from https://github.com/kubernetes/apimachinery/blob/master/pkg/api/meta/conditions.go
@@ -43,6 +46,23 @@ func IsJobStatusConditionPresentAndEqual(conditions []batchv1.JobCondition, cond
 	return false
 }
 
+// GetJobFailure describes why the job failed when its Failed or FailureTarget condition is true, or returns the empty string.
+// The FailureTarget condition is set as soon as the job is going to fail (e.g. through its podFailurePolicy), before its pods are terminated.
+func GetJobFailure(job *batchv1.Job) string {
+	for _, conditionType := range []batchv1.JobConditionType{batchv1.JobFailed, batchv1.JobFailureTarget} {
+		for _, condition := range job.Status.Conditions {
+			if condition.Type != conditionType || condition.Status != corev1.ConditionTrue {
+				continue
+			}
+			if condition.Message == "" {
+				return fmt.Sprintf("%s (%s)", condition.Type, condition.Reason)
+			}
+			return fmt.Sprintf("%s (%s: %s)", condition.Type, condition.Reason, condition.Message)
+		}
+	}
+	return ""
+}
+
 // IsPodStatusConditionTrue returns true when the conditionType is present and set to `metav1.ConditionTrue`
 func IsPodStatusConditionTrue(conditions []corev1.PodCondition, conditionType corev1.PodConditionType) bool {
 	return IsPodStatusConditionPresentAndEqual(conditions, conditionType, corev1.ConditionTrue)
@@ -62,3 +82,57 @@ func IsPodStatusConditionPresentAndEqual(conditions []corev1.PodCondition, condi
 	}
 	return false
 }
+
+// GetUnstructuredStatusCondition returns the status and reason of the conditionType in `.status.conditions` and whether it is present.
+func GetUnstructuredStatusCondition(obj *unstructured.Unstructured, conditionType string) (string, string, bool) {
+	condition, found := getUnstructuredStatusCondition(obj, conditionType)
+	if !found {
+		return "", "", false
+	}
+	status, _, _ := unstructured.NestedString(condition, "status")
+	reason, _, _ := unstructured.NestedString(condition, "reason")
+	return status, reason, true
+}
+
+// GetUnstructuredWorkloadFailure describes why the rollout of a workload (e.g. a Deployment) can not make progress anymore,
+// because its Progressing condition is false with reason ProgressDeadlineExceeded or its ReplicaFailure condition is true.
+// It returns the empty string otherwise.
+func GetUnstructuredWorkloadFailure(obj *unstructured.Unstructured) string {
+	for _, failure := range []struct{ conditionType, status, reason string }{
+		{"Progressing", "False", "ProgressDeadlineExceeded"},
+		{"ReplicaFailure", "True", ""},
+	} {
+		condition, found := getUnstructuredStatusCondition(obj, failure.conditionType)
+		if !found {
+			continue
+		}
+		status, _, _ := unstructured.NestedString(condition, "status")
+		reason, _, _ := unstructured.NestedString(condition, "reason")
+		message, _, _ := unstructured.NestedString(condition, "message")
+		if status != failure.status || (failure.reason != "" && reason != failure.reason) {
+			continue
+		}
+		if message == "" {
+			return fmt.Sprintf("%s (%s)", failure.conditionType, reason)
+		}
+		return fmt.Sprintf("%s (%s: %s)", failure.conditionType, reason, message)
+	}
+	return ""
+}
+
+func getUnstructuredStatusCondition(obj *unstructured.Unstructured, conditionType string) (map[string]interface{}, bool) {
+	conditions, found, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if err != nil || !found {
+		return nil, false
+	}
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if t, _, _ := unstructured.NestedString(condition, "type"); t == conditionType {
+			return condition, true
+		}
+	}
+	return nil, false
+}